@@ -13,6 +13,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
@@ -245,9 +246,10 @@ func (s *Server) processTenant(ctx context.Context, req *pb.TenantRequest, actio
 		return nil, status.Errorf(codes.Internal, "Failed to acquire hash from configmap: %v", err)
 	}
 
-	containerConfigHash, err := getConfigHashFromContainer(ctx, s.configHashEndpoint)
+	configHashEndpoint := s.configHashEndpoint + "/" + url.PathEscape(configData.Namespace)
+	containerConfigHash, err := getConfigHashFromContainer(ctx, configHashEndpoint)
 	if err != nil {
-		log.Printf("Failed to acquire hash from endpoint %s: %v", s.configHashEndpoint, err)
+		log.Printf("Failed to acquire hash from endpoint %s: %v", configHashEndpoint, err)
 		return nil, status.Errorf(codes.Unavailable, "Failed to acquire hash from container: %v", err)
 	}
 
@@ -391,7 +393,7 @@ func sendReloadRequestToContainer(ctx context.Context, endpoint string) error {
 	return nil
 }
 
-// getConfigHashFromContainer sends a GET request to the given endpoint
+// getConfigHashFromContainer sends a GET request to the config hash endpoint of a namespace
 // and returns the response body as a string on success.
 func getConfigHashFromContainer(ctx context.Context, endpoint string) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
@@ -419,13 +421,11 @@ func getConfigHashFromContainer(ctx context.Context, endpoint string) (string, e
 
 // addTenant adds a new tenant to the mimirOrg field in the configuration if it doesn't already exist.
 func addTenant(configMap *corev1.ConfigMap, configName, tenant string) (models.Configuration, codes.Code, error) {
-	jsonData := configMap.Data[configName]
-
-	var configData models.Configuration
-	err := json.Unmarshal([]byte(jsonData), &configData)
+	config, err := impl.ParseConfig(configName, []byte(configMap.Data[configName]))
 	if err != nil {
 		return models.Configuration{}, codes.Internal, fmt.Errorf("failed to unmarshal ConfigMap data: %w", err)
 	}
+	configData := *config
 
 	tenantList := strings.Split(configData.Source.Org, "|")
 	if slices.Contains(tenantList, tenant) {
@@ -440,13 +440,11 @@ func addTenant(configMap *corev1.ConfigMap, configName, tenant string) (models.C
 
 // removeTenant removes an existing tenant from the mimirOrg field in the configuration.
 func removeTenant(configMap *corev1.ConfigMap, configName, tenant string) (models.Configuration, codes.Code, error) {
-	jsonData := configMap.Data[configName]
-
-	var configData models.Configuration
-	err := json.Unmarshal([]byte(jsonData), &configData)
+	config, err := impl.ParseConfig(configName, []byte(configMap.Data[configName]))
 	if err != nil {
 		return models.Configuration{}, codes.Internal, fmt.Errorf("failed to unmarshal ConfigMap data: %w", err)
 	}
+	configData := *config
 
 	tenantList := strings.Split(configData.Source.Org, "|")
 	updatedTenants := slices.DeleteFunc(tenantList, func(t string) bool {
@@ -458,7 +458,7 @@ func TestProcessTenant(t *testing.T) {
 			w.WriteHeader(http.StatusOK)
 			_, err := w.Write([]byte("success"))
 			require.NoError(t, err, "Failed to write response")
-		case "/confighash":
+		case "/confighash/orch_edgenode":
 			w.WriteHeader(http.StatusOK)
 			// return hash of initialConfig. Instruction for update:
 			// 1. run `go test -v -run TestProcessTenant ./...`
@@ -5,7 +5,22 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
+	"log"
 	"strings"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/impl"
+)
+
+// Offline commands of metrics-exporter, given as the first argument.
+const (
+	validateCommand = "validate"
+	dryRunCommand   = "dry-run"
+
+	// exitFailure is the exit code of an offline command for invalid configs or failed queries
+	exitFailure = 1
+	exitUsage   = 2
 )
 
 type argList []string
@@ -22,15 +37,19 @@ func (URIs *argList) Set(value string) error {
 var (
 	vaultURIs      argList
 	configFiles    argList
+	configDirs     argList
 	listenAddress  = flag.String("listenAddress", ":9141", "local <address>:port for sre-exporter to listen on")
 	customerLabel  = flag.String("customerLabel", "UNKNOWN_CUSTOMER", "Value of the customer label to use in the exported metrics")
 	vaultNamespace = flag.String("vaultNamespace", "orch-platform", "K8S namespace where vault pods are running")
+	watchConfig    = flag.Bool("watchConfig", false, "reloads the pipelines of the config files when they change")
 	ver            = flag.Bool("version", false, "prints current version")
 
 	startUpFmt = `
 Metrics-Exporter v%s starting up with the following parameters:
 	vaultURIs: %s
 	configFiles: %s
+	configDirs: %s
+	watchConfig: %t
 	listenAddress: %s
 	customerLabel: %s
 	vaultNamespace: %s`
@@ -38,6 +57,57 @@ Metrics-Exporter v%s starting up with the following parameters:
 
 func parseArgs() {
 	flag.Var(&configFiles, "config", "filename of json file that holds collector and metric data")
+	flag.Var(&configDirs, "configDir", "directory or glob pattern of the config files NOTE this can be set multiple times")
 	flag.Var(&vaultURIs, "vaultURI", "URI to contact vault via NOTE this can be set multiple times")
 	flag.Parse() //nolint:revive // Keep Parse call as file is part of main package
 }
+
+// commandFlags are the flags shared by the offline commands of metrics-exporter.
+type commandFlags struct {
+	// configFiles are the config files followed by the files of the config dirs, as loaded by the server
+	configFiles argList
+	configDirs  argList
+	customer    *string
+	verbose     *bool
+}
+
+// parseCommandFlags parses the arguments of an offline command, it returns false on wrong usage.
+func parseCommandFlags(command string, args []string, stderr io.Writer) (*commandFlags, bool) {
+	commandArgs := &commandFlags{}
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&commandArgs.configFiles, "config", "filename of json or yaml config file NOTE this can be set multiple times")
+	flags.Var(&commandArgs.configDirs, "configDir", "directory or glob pattern of the config files NOTE this can be set multiple times")
+	commandArgs.customer = flags.String("customerLabel", "UNKNOWN_CUSTOMER", "Value of the customer label to use in the exported metrics")
+	commandArgs.verbose = flags.Bool("verbose", false, "prints the logs to stderr")
+	if err := flags.Parse(args); err != nil {
+		return nil, false
+	}
+	if len(commandArgs.configFiles)+len(commandArgs.configDirs) == 0 || flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "usage: metrics-exporter %s --config <file> | --configDir <dir> [--config <file> | --configDir <dir> ...]\n", command)
+		return nil, false
+	}
+	files, err := impl.ResolveConfigFiles(commandArgs.configFiles, commandArgs.configDirs)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to resolve config files: %v\n", err)
+		return nil, false
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(stderr, "no config files found in %s\n", commandArgs.configDirs.String())
+		return nil, false
+	}
+	commandArgs.configFiles = files
+	return commandArgs, true
+}
+
+// redirectLogs sends the logs to stderr when verbose is set and discards them otherwise,
+// the returned function restores the previous log output.
+func redirectLogs(verbose bool, stderr io.Writer) func() {
+	logOutput := log.Writer()
+	if verbose {
+		log.SetOutput(stderr)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+	return func() { log.SetOutput(logOutput) }
+}
@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/impl"
+)
+
+// runDryRun runs the queries of the config files once and writes the metrics which would be exported to stdout,
+// without starting the server. It returns the exit code of the command.
+func runDryRun(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	commandArgs, ok := parseCommandFlags(dryRunCommand, args, stderr)
+	if !ok {
+		return exitUsage
+	}
+	defer redirectLogs(*commandArgs.verbose, stderr)()
+
+	if err := impl.DryRun(ctx, commandArgs.configFiles, *commandArgs.customer, stdout); err != nil {
+		fmt.Fprintf(stderr, "dry run failed: %v\n", err)
+		return exitFailure
+	}
+	return 0
+}
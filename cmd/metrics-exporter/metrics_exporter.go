@@ -34,6 +34,19 @@ var (
 )
 
 func main() {
+	// offline commands, the server is not started
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case validateCommand:
+			os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+		case dryRunCommand:
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			exitCode := runDryRun(ctx, os.Args[2:], os.Stdout, os.Stderr)
+			stop()
+			os.Exit(exitCode)
+		}
+	}
+
 	parseArgs()
 
 	if *ver {
@@ -41,7 +54,8 @@ func main() {
 		os.Exit(0)
 	}
 
-	startUpMessage := fmt.Sprintf(startUpFmt, version, vaultURIs, configFiles, *listenAddress, *customerLabel, *vaultNamespace)
+	startUpMessage := fmt.Sprintf(startUpFmt, version, vaultURIs, configFiles, configDirs, *watchConfig,
+		*listenAddress, *customerLabel, *vaultNamespace)
 	log.Println(color.FormatString(color.Info, startUpMessage))
 
 	// Run scraping goroutine which scrapes OpenTelemetry Collector endpoint
@@ -51,40 +65,41 @@ func main() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	// the loop running main server goroutine
-	// restarts on SIGHUP signal sent to reload the configuration
-	serverStarted := false
-	for {
-		err := initializePipelineManager(pipelineManager, configFiles, vaultURIs, vaultNamespace, customerLabel, done)
-		if err != nil {
-			log.Fatalf("Failed to initialize pipeline manager: %v", err)
+	// changes of the config files are handled by the main loop, so that reloads never overlap
+	configChanges := make(chan []string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *watchConfig {
+		if err := runConfigWatcher(ctx, configChanges); err != nil {
+			log.Fatalf("Failed to watch config files: %v", err)
 		}
+	}
 
-		// start the server only once
-		if !serverStarted {
-			go func() {
-				log.Print("Serving metrics")
-				if err := pipelineManager.Start(); !errors.Is(err, http.ErrServerClosed) {
-					log.Fatalf("Server error: %v", err)
-				}
-			}()
-			serverStarted = true
+	// reloads build the changed pipelines off to the side, the previous ones keep serving when a reload fails
+	reloader := impl.NewReloader(pipelineManager, configFiles, configDirs, *customerLabel)
+	err := initializePipelineManager(pipelineManager, reloader, vaultURIs, vaultNamespace, customerLabel)
+	if err != nil {
+		log.Fatalf("Failed to initialize pipeline manager: %v", err)
+	}
+	go func() {
+		log.Print("Serving metrics")
+		if err := pipelineManager.Start(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
 		}
+	}()
 
-		// Blocks here
-		sig := <-done
-		// signal other than SIGHUP received, shutdown the server
-		if sig != syscall.SIGHUP {
-			log.Printf("Received signal: %v", sig)
-			break
-		}
+	// the loop running main server goroutine
+	// reloads the changed pipelines on SIGHUP signal sent to reload the configuration and on config file changes
+	for trigger, ok := waitForReload(done, configChanges); ok; trigger, ok = waitForReload(done, configChanges) {
+		reloader.Reload(trigger)
 	}
 	log.Print("Server shutting down")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
 
-	if err := pipelineManager.Shutdown(ctx); err != nil {
+	if err := pipelineManager.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Graceful server shutdown failed: %v", err)
 		if err := pipelineManager.Close(); err != nil {
 			log.Panicf("Could not properly close the server: %v", err)
@@ -95,25 +110,10 @@ func main() {
 }
 
 // initializePipelineManager initializes the pipeline manager and returns it along with any error encountered.
-func initializePipelineManager(pipelineManager *impl.PipelineManager, configFiles []string, vaultURIs []string,
-	vaultNamespace, customerLabel *string, done chan os.Signal) error {
-	pipelines := make([]*impl.Pipeline, 0) //nolint:prealloc // Keep current configuration
-	configHash := make(map[string]string)
-
-	for i := range configFiles {
-		config, hash, err := impl.InitConfig(&configFiles[i])
-		if err != nil {
-			return fmt.Errorf("failed to initialize config: %w", err)
-		}
-		configHash[config.Namespace] = hash
-
-		collectors, err := metrics.BuildCollectorsFromConfig(config, *customerLabel)
-		if err != nil {
-			return fmt.Errorf("failed to build collectors: %w", err)
-		}
-		pipeline := impl.NewPipeline(config.Namespace)
-		pipeline.AddCollectors(collectors...)
-		pipelines = append(pipelines, pipeline)
+func initializePipelineManager(pipelineManager *impl.PipelineManager, reloader *impl.Reloader, vaultURIs []string,
+	vaultNamespace, customerLabel *string) error {
+	if status := reloader.Reload(impl.ReloadTriggerStartup); !status.Success {
+		return errors.New(status.Error)
 	}
 
 	vaultCollector, err := newVaultCollector(vaultURIs, vaultNamespace, customerLabel)
@@ -122,19 +122,53 @@ func initializePipelineManager(pipelineManager *impl.PipelineManager, configFile
 	}
 	pipeline := impl.NewPipeline("vault")
 	pipeline.AddCollectors(vaultCollector)
-	pipelines = append(pipelines, pipeline)
-
-	for i := range pipelines {
-		pipelineManager.RegisterPipeline("/"+pipelines[i].GetNamespace()+"/metrics", pipelines[i])
-	}
+	pipelineManager.RegisterPipeline(impl.PipelineEndpoint(pipeline.GetNamespace()), pipeline)
 
 	// Register health check
 	pipelineManager.RegisterHealthCheck()
 	// Register the reload endpoint
-	pipelineManager.RegisterReload("/reload", done)
-	// Register the config hash endpoint with edgenode configmap hash
-	pipelineManager.RegisterConfigHash("/confighash", configHash["orch_edgenode"])
+	pipelineManager.RegisterReload("/reload", reloader)
+	pipelineManager.RegisterExporterMetrics("/exporter/metrics")
+	// Register the config hash endpoints with the hashes of all the configurations
+	pipelineManager.RegisterConfigHash("/confighash")
+
+	return nil
+}
+
+// waitForReload blocks until a reload is requested by SIGHUP or by config file changes and returns its trigger.
+// It returns false when another signal is received and the server must shut down.
+func waitForReload(done <-chan os.Signal, configChanges <-chan []string) (string, bool) {
+	select {
+	case sig := <-done:
+		// signal other than SIGHUP received, shutdown the server
+		if sig != syscall.SIGHUP {
+			log.Printf("Received signal: %v", sig)
+			return "", false
+		}
+		log.Print("Reloading changed pipelines")
+		return impl.ReloadTriggerSignal, true
+	case changed := <-configChanges:
+		log.Printf("Reloading pipelines of changed config files: %v", changed)
+		return impl.ReloadTriggerWatch, true
+	}
+}
 
+// runConfigWatcher starts watching the config files and config dirs, the changed files are sent to the channel.
+func runConfigWatcher(ctx context.Context, configChanges chan<- []string) error {
+	watcher, err := impl.NewConfigWatcher(configFiles, configDirs, func(changed []string) {
+		select {
+		case configChanges <- changed:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := watcher.Run(ctx); err != nil {
+			log.Printf("Config watcher stopped: %v", err)
+		}
+	}()
 	return nil
 }
 
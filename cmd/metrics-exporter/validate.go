@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/impl"
+)
+
+type validationReport struct {
+	Valid    bool                     `json:"valid"`
+	Files    []string                 `json:"files"`
+	Problems []impl.ValidationProblem `json:"problems"`
+}
+
+// runValidate checks the config files offline, without connecting to Kubernetes or to the query source.
+// It writes a JSON report to stdout and returns the exit code of the command.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	commandArgs, ok := parseCommandFlags(validateCommand, args, stderr)
+	if !ok {
+		return exitUsage
+	}
+	// the report is the only output unless verbose is set
+	defer redirectLogs(*commandArgs.verbose, stderr)()
+
+	report := validationReport{Valid: true, Files: commandArgs.configFiles, Problems: []impl.ValidationProblem{}}
+	var validationErr *impl.ValidationError
+	if err := impl.CheckConfigFiles(commandArgs.configFiles, *commandArgs.customer); errors.As(err, &validationErr) {
+		report.Valid = false
+		report.Problems = validationErr.Problems
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(stderr, "failed to write validation report: %v\n", err)
+		return exitUsage
+	}
+	if !report.Valid {
+		return exitFailure
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{
+		"namespace": "orch",
+		"source": {"queryURI": "http://localhost:8181/prometheus"},
+		"collectors": [{"name": "api", "enabled": true, "metrics": [{"id": "targets", "query": "up", "Type": "Gauge"}]}]
+	}`), 0o600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{
+		"namespace": "orch",
+		"source": {"queryURI": "http://localhost:8181/prometheus"},
+		"collectors": [{"name": "api", "enabled": true, "metrics": [{"id": "targets", "query": "up(", "Type": "Gauge"}]}]
+	}`), 0o600))
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		problems int
+	}{
+		{name: "valid", args: []string{"--config", valid}, exitCode: 0},
+		{name: "invalid", args: []string{"--config", valid, "--config", invalid}, exitCode: exitFailure, problems: 2},
+		{name: "config dir", args: []string{"--configDir", dir}, exitCode: exitFailure, problems: 2},
+		{name: "config dir pattern", args: []string{"--configDir", filepath.Join(dir, "valid*.json")}, exitCode: 0},
+		{name: "empty config dir", args: []string{"--configDir", t.TempDir()}, exitCode: exitUsage},
+		{name: "no config", args: []string{}, exitCode: exitUsage},
+		{name: "unknown flag", args: []string{"--listenAddress", ":9141"}, exitCode: exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			require.Equal(t, tt.exitCode, runValidate(tt.args, &stdout, &stderr))
+			if tt.exitCode == exitUsage {
+				require.Empty(t, stdout.String())
+				return
+			}
+
+			var report validationReport
+			require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+			require.Equal(t, tt.exitCode == 0, report.Valid)
+			require.Len(t, report.Problems, tt.problems)
+			require.Empty(t, stderr.String())
+		})
+	}
+}
@@ -4,45 +4,308 @@
 package impl
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
 
 	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
 )
 
+const fileReferencePrefix = "file://"
+
+// envReference matches the ${VAR} environment variable references of the source fields.
+var envReference = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
 // InitConfig reads the configuration file and unmarshals it into a Configuration struct
-// It returns hash of initial configuration and modifies it by normalizing the destination labels.
+// It returns the hash of the configuration and modifies it by normalizing the destination labels
+// and by expanding the environment variable and file references of the sources.
 func InitConfig(configFile *string) (*models.Configuration, string, error) {
-	var workingConfig = models.Configuration{}
-
-	bytes, err := readConfig(configFile)
+	configBytes, err := readConfig(configFile)
 	if err != nil {
 		return nil, "", fmt.Errorf("error reading configuration file: %w", err)
 	}
 
-	err = json.Unmarshal(bytes, &workingConfig)
+	config, err := ParseConfig(*configFile, configBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	// references are expanded after logging, so that the values read from the files are not logged
+	log.Printf("InitConfig startup config %+v", *config)
+	workingConfig, hash, _, err := expandConfig(*configFile, config)
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to unmarshal: %w", err)
+		return nil, "", err
 	}
+	normalizeDestLabels(workingConfig)
+	return workingConfig, hash, nil
+}
 
-	// get hash of original configuration
-	hash, err := GetConfigHash(&workingConfig)
+// expandConfig returns a copy of the configuration with the references of its sources expanded, along with
+// its hash and the files read by its sources. The hash of the configuration as written is mixed with the expanded
+// sources and with the content of the files, so that the configuration is reloaded when a referenced value changes.
+// The hash of a configuration without references is the one of the configuration as written, the config-reloader
+// computes it from the ConfigMap.
+func expandConfig(configFile string, config *models.Configuration) (*models.Configuration, string, []string, error) {
+	hash, err := GetConfigHash(config)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to acquire hash: %w", err)
+		return nil, "", nil, fmt.Errorf("failed to acquire hash: %w", err)
+	}
+
+	expanded := *config
+	configDir := filepath.Dir(configFile)
+	files, err := expandSource(&expanded.Source, configDir)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+	if len(config.Sources) > 0 {
+		expanded.Sources = make(map[string]models.Source, len(config.Sources))
+		for name, source := range config.Sources {
+			sourceFiles, err := expandSource(&source, configDir)
+			if err != nil {
+				return nil, "", nil, fmt.Errorf("%s: sources %q: %w", configFile, name, err)
+			}
+			expanded.Sources[name] = source
+			files = append(files, sourceFiles...)
+		}
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	hash, err = mixReferences(hash, config, &expanded, files)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to acquire hash: %w", err)
+	}
+	return &expanded, hash, files, nil
+}
+
+// mixReferences mixes the expanded sources and the content of the files they read into the hash,
+// the hash is returned unchanged when the sources have no references.
+func mixReferences(hash string, config, expanded *models.Configuration, files []string) (string, error) {
+	sources, err := json.Marshal([]any{config.Source, config.Sources})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sources: %w", err)
+	}
+	expandedSources, err := json.Marshal([]any{expanded.Source, expanded.Sources})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sources: %w", err)
+	}
+	if len(files) == 0 && bytes.Equal(sources, expandedSources) {
+		return hash, nil
+	}
+
+	data := append([]byte(hash), expandedSources...)
+	for _, file := range files {
+		data = append(data, file...)
+		// a missing file is hashed as such, it can be created later, e.g. by a secret mount
+		if content, err := os.ReadFile(file); err == nil {
+			digest := sha256.Sum256(content)
+			data = append(data, digest[:]...)
+		}
+	}
+	return getHash(data), nil
+}
+
+// expandSource expands the ${VAR} environment variable references in the source fields and then replaces
+// the fields starting with file:// with the content of the referenced file, without leading and trailing spaces.
+// Relative file paths, of the references and of the files read by the source, are resolved from the directory
+// of the configuration file. It returns the files referenced by the source fields and the files read by the source.
+func expandSource(source *models.Source, configDir string) ([]string, error) {
+	type field struct {
+		name  string
+		value *string
+	}
+	fields := []field{
+		{name: "queryURI", value: &source.URI},
+		{name: "mimirOrg", value: &source.Org},
+	}
+	paths := []*string{&source.BearerTokenFile}
+	// the auth configurations are copied, so that the parsed configuration is not changed
+	if source.BasicAuth != nil {
+		basicAuth := *source.BasicAuth
+		source.BasicAuth = &basicAuth
+		fields = append(fields, field{name: "basicAuth username", value: &basicAuth.Username},
+			field{name: "basicAuth password", value: &basicAuth.Password})
+		paths = append(paths, &basicAuth.PasswordFile)
+	}
+	if source.OAuth2 != nil {
+		oauth2 := *source.OAuth2
+		source.OAuth2 = &oauth2
+		fields = append(fields, field{name: "oauth2 clientId", value: &oauth2.ClientID},
+			field{name: "oauth2 clientSecret", value: &oauth2.ClientSecret})
+		paths = append(paths, &oauth2.ClientSecretFile)
+	}
+	if source.TLS != nil {
+		tlsConfig := *source.TLS
+		source.TLS = &tlsConfig
+		paths = append(paths, &tlsConfig.CAFile, &tlsConfig.CertFile, &tlsConfig.KeyFile)
+	}
+	if source.Fallback != nil {
+		fallback := *source.Fallback
+		fallback.QueryURIs = slices.Clone(fallback.QueryURIs)
+		source.Fallback = &fallback
+		for i := range fallback.QueryURIs {
+			fields = append(fields, field{name: fmt.Sprintf("fallback queryURIs[%d]", i), value: &fallback.QueryURIs[i]})
+		}
+	}
+
+	var files []string
+	for _, field := range fields {
+		value, file, err := expandValue(*field.value, configDir)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", field.name, err)
+		}
+		*field.value = value
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	for _, path := range paths {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(configDir, *path)
+		}
+		if *path != "" {
+			files = append(files, *path)
+		}
+	}
+	return files, nil
+}
+
+// expandValue returns the value with its references expanded, along with the path of the file it was read from.
+func expandValue(value, configDir string) (string, string, error) {
+	var missing []string
+	value = envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return envValue
+	})
+	if len(missing) > 0 {
+		return "", "", fmt.Errorf("environment variable(s) %s not set", strings.Join(missing, ", "))
+	}
+
+	path, ok := strings.CutPrefix(value, fileReferencePrefix)
+	if !ok {
+		return value, "", nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading referenced file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), path, nil
+}
+
+// LoadConfigs loads and validates the config files, it returns the configurations
+// along with the hashes of their namespaces.
+func LoadConfigs(configFiles []string) ([]*models.Configuration, map[string]string, error) {
+	configs := make([]*models.Configuration, len(configFiles))
+	configHash := make(map[string]string, len(configFiles))
+	for i := range configFiles {
+		config, hash, err := InitConfig(&configFiles[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize config: %w", err)
+		}
+		configHash[config.Namespace] = hash
+		configs[i] = config
+	}
+	// report all problems of all configs before any pipeline is built
+	if err := ValidateConfigs(configFiles, configs); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return configs, configHash, nil
+}
+
+// ParseConfig decodes the configuration, YAML when the file name has a .yaml or .yml extension and JSON otherwise.
+// Unknown fields are rejected, errors point at the file and at the index of the collector and metric.
+func ParseConfig(fileName string, data []byte) (*models.Configuration, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".yaml", ".yml":
+		jsonData, err := yaml.YAMLToJSONStrict(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid YAML: %w", fileName, err)
+		}
+		data = jsonData
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return config, nil
+}
+
+// decodeConfig decodes the configuration level by level, so that errors can be located in the collectors and metrics.
+func decodeConfig(data []byte) (*models.Configuration, error) {
+	var rawConfig struct {
+		models.Configuration
+		Collectors []json.RawMessage `json:"collectors"`
+	}
+	if err := decodeStrict(data, &rawConfig); err != nil {
+		return nil, err
+	}
+
+	config := rawConfig.Configuration
+	config.Collectors = nil
+	if rawConfig.Collectors != nil {
+		config.Collectors = make([]models.Collector, len(rawConfig.Collectors))
+	}
+	for i, collectorData := range rawConfig.Collectors {
+		var rawCollector struct {
+			models.Collector
+			Metrics []json.RawMessage `json:"metrics"`
+		}
+		if err := decodeStrict(collectorData, &rawCollector); err != nil {
+			return nil, fmt.Errorf("collector %d: %w", i, err)
+		}
+
+		collector := rawCollector.Collector
+		collector.Metrics = nil
+		if rawCollector.Metrics != nil {
+			collector.Metrics = make([]models.Metric, len(rawCollector.Metrics))
+		}
+		for j, metricData := range rawCollector.Metrics {
+			if err := decodeStrict(metricData, &collector.Metrics[j]); err != nil {
+				return nil, fmt.Errorf("collector %d (%q) metric %d: %w", i, collector.Name, j, err)
+			}
+		}
+		config.Collectors[i] = collector
+	}
+	return &config, nil
+}
+
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("unable to unmarshal: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("unable to unmarshal: unexpected data after the configuration")
 	}
-	normalizeDestLabels(&workingConfig)
-	log.Printf("InitConfig startup config %+v", workingConfig)
-	return &workingConfig, hash, nil
+	return nil
 }
 
+// normalizeDestLabels exports the metrics without destination labels with their source labels, destination labels
+// not matching the source labels are left for the validation to report.
 func normalizeDestLabels(configuration *models.Configuration) {
 	for i := 0; i < len(configuration.Collectors); i++ {
 		collector := &configuration.Collectors[i]
 		for j := 0; j < len(collector.Metrics); j++ {
 			metric := &collector.Metrics[j]
-			if len(metric.DestLabels) != len(metric.Labels) {
+			if len(metric.DestLabels) == 0 {
 				metric.DestLabels = make([]string, len(metric.Labels))
 				copy(metric.DestLabels, metric.Labels)
 			}
@@ -9,8 +9,13 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 
 	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
@@ -293,6 +298,328 @@ func Test_InitConfig(t *testing.T) {
 	})
 }
 
+func Test_InitConfigExpandSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "secrets"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets", "org"), []byte("orch-system|edgenode\n"), 0600))
+	t.Setenv("SRE_TEST_QUERY_HOST", "mimir.orch-platform")
+	t.Setenv("SRE_TEST_SECRETS", filepath.Join(tmpDir, "secrets"))
+
+	writeConfig := func(name, source string) string {
+		configFilePath := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(configFilePath, []byte(`{"namespace": "orch", "source": `+source+`}`), 0600))
+		return configFilePath
+	}
+
+	t.Run("expanded", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			source string
+		}{
+			{name: "absolute file", source: `{"queryURI": "http://${SRE_TEST_QUERY_HOST}:8080/prometheus", "mimirOrg": "file://${SRE_TEST_SECRETS}/org"}`},
+			{name: "relative file", source: `{"queryURI": "http://${SRE_TEST_QUERY_HOST}:8080/prometheus", "mimirOrg": "file://secrets/org"}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				configFilePath := writeConfig("config.json", tt.source)
+				out, hash, err := InitConfig(&configFilePath)
+				require.NoError(t, err)
+				require.Equal(t, "http://mimir.orch-platform:8080/prometheus", out.Source.URI)
+				require.Equal(t, "orch-system|edgenode", out.Source.Org)
+
+				// the hash covers the referenced values
+				data, err := os.ReadFile(configFilePath)
+				require.NoError(t, err)
+				config, err := ParseConfig(configFilePath, data)
+				require.NoError(t, err)
+				writtenHash, err := GetConfigHash(config)
+				require.NoError(t, err)
+				require.NotEqual(t, writtenHash, hash)
+			})
+		}
+	})
+
+	t.Run("hash of references", func(t *testing.T) {
+		configFilePath := writeConfig("config_hash.json", `{"queryURI": "http://${SRE_TEST_QUERY_HOST}", "mimirOrg": "file://secrets/org",
+			"tls": {"caFile": "secrets/ca.crt"}}`)
+		_, hash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		_, sameHash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.Equal(t, hash, sameHash)
+
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets", "org"), []byte("orch-system\n"), 0600))
+		t.Cleanup(func() {
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets", "org"), []byte("orch-system|edgenode\n"), 0600))
+		})
+		_, orgHash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.NotEqual(t, hash, orgHash)
+
+		// the files read by the source are covered too
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets", "ca.crt"), []byte("CA"), 0600))
+		_, caHash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.NotEqual(t, orgHash, caHash)
+
+		t.Setenv("SRE_TEST_QUERY_HOST", "mimir")
+		_, hostHash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.NotEqual(t, caHash, hostHash)
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		t.Setenv("SRE_TEST_PASSWORD", "secret")
+		configFilePath := writeConfig("config_auth.json", `{"queryURI": "https://localhost",
+			"basicAuth": {"username": "file://secrets/org", "password": "${SRE_TEST_PASSWORD}"},
+			"oauth2": {"clientId": "sre", "clientSecretFile": "secrets/client-secret", "tokenURL": "https://keycloak/token"},
+			"tls": {"caFile": "/etc/ssl/ca.crt", "certFile": "tls/client.crt", "keyFile": "tls/client.key"}}`)
+		out, _, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.Equal(t, &models.BasicAuth{Username: "orch-system|edgenode", Password: "secret"}, out.Source.BasicAuth)
+		require.Equal(t, filepath.Join(tmpDir, "secrets", "client-secret"), out.Source.OAuth2.ClientSecretFile)
+		require.Equal(t, &models.TLSConfig{
+			CAFile:   "/etc/ssl/ca.crt",
+			CertFile: filepath.Join(tmpDir, "tls", "client.crt"),
+			KeyFile:  filepath.Join(tmpDir, "tls", "client.key"),
+		}, out.Source.TLS)
+	})
+
+	t.Run("named sources", func(t *testing.T) {
+		configFilePath := filepath.Join(tmpDir, "config_sources.json")
+		require.NoError(t, os.WriteFile(configFilePath, []byte(`{"namespace": "orch", "source": {"queryURI": "http://localhost"},
+			"sources": {"platform": {"queryURI": "http://${SRE_TEST_QUERY_HOST}:9090", "mimirOrg": "file://secrets/org"}}}`), 0600))
+		out, _, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.Equal(t, map[string]models.Source{
+			"platform": {URI: "http://mimir.orch-platform:9090", Org: "orch-system|edgenode"},
+		}, out.Sources)
+
+		require.NoError(t, os.WriteFile(configFilePath, []byte(`{"namespace": "orch",
+			"sources": {"platform": {"queryURI": "http://${SRE_TEST_UNSET_HOST}"}}}`), 0600))
+		_, _, err = InitConfig(&configFilePath)
+		require.ErrorContains(t, err, `sources "platform": source queryURI: environment variable(s) SRE_TEST_UNSET_HOST not set`)
+	})
+
+	t.Run("fallback query URIs", func(t *testing.T) {
+		configFilePath := filepath.Join(tmpDir, "config_fallback.json")
+		require.NoError(t, os.WriteFile(configFilePath, []byte(`{"namespace": "orch", "source": {"queryURI": "http://mimir-0",
+			"fallback": {"queryURIs": ["http://${SRE_TEST_QUERY_HOST}:9090"], "strategy": "hedged", "hedgeDelay": "250ms"}}}`), 0600))
+		out, _, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.Equal(t, &models.Fallback{
+			QueryURIs:  []string{"http://mimir.orch-platform:9090"},
+			Strategy:   models.FallbackStrategyHedged,
+			HedgeDelay: model.Duration(250 * time.Millisecond),
+		}, out.Source.Fallback)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			source string
+			err    string
+		}{
+			{
+				name:   "unset variable",
+				source: `{"queryURI": "http://${SRE_TEST_UNSET_HOST}:${SRE_TEST_UNSET_PORT}/prometheus"}`,
+				err:    "source queryURI: environment variable(s) SRE_TEST_UNSET_HOST, SRE_TEST_UNSET_PORT not set",
+			},
+			{
+				name:   "missing file",
+				source: `{"queryURI": "http://localhost", "mimirOrg": "file://secrets/missing"}`,
+				err:    "source mimirOrg: error reading referenced file:",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				configFilePath := writeConfig("config_error.json", tt.source)
+				out, hash, err := InitConfig(&configFilePath)
+				require.ErrorContains(t, err, configFilePath+": "+tt.err)
+				require.Nil(t, out)
+				require.Empty(t, hash)
+			})
+		}
+	})
+}
+
+const yamlPatternEmptyLabels = `
+namespace: orch
+collectors:
+  - name: NodeCollector
+    enabled: true
+    metrics:
+      - name: nodeCpuTotalQuery
+        query: sum by (instance,mode) (node_cpu_seconds_total)
+        id: cpu_total
+        help: CPU seconds per mode by mode (idle,system,steal etc)
+        labels: [instance, mode]
+      - name: nodeMemTotalQuery
+        query: node_memory_MemTotal_bytes
+        id: memory_MemTotal_bytes
+        help: Total memory on node
+        labels: [instance]
+      - name: nodeMemAvailQuery
+        query: node_memory_MemAvailable_bytes
+        id: memory_MemAvail_byes
+        help: Current available memory on node
+        labels: [instance]
+  - name: api
+    enabled: true
+    metrics:
+      - name: traefikRequestsTotalQuery
+        query: traefik_service_requests_total
+        id: requests_all
+        help: The total count of HTTP request processed
+        labels: [code, exported_service, method, protocol, instance, namespace, pod]
+        destLabels: [status, target_service, method, protocol, gw_instance, gw_namespace, gw_pod]
+      - name: traefikDurationQuery
+        query: traefik_service_request_duration_seconds_bucket
+        id: request_latency_seconds_all
+        help: Histogram of HTTP request latencies
+        labels: [code, exported_service, method, protocol, instance, namespace, pod, le]
+        destLabels: [status, target_service, method, protocol, gw_instance, gw_namespace, gw_pod, le]
+`
+
+func Test_InitConfigYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		configFilePath := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(configFilePath, []byte(yamlPatternEmptyLabels), 0640))
+
+		var configurationExpected models.Configuration
+		require.NoError(t, json.Unmarshal([]byte(jsonPatternEmptyLabelsExpected), &configurationExpected))
+
+		out, hash, err := InitConfig(&configFilePath)
+		require.NoError(t, err)
+		require.Equal(t, &configurationExpected, out)
+		// the hash does not depend on the format of the file
+		require.Equal(t, "372a1dd4556468c7237d55cac8e46bbb2a1f0c0485db158e0730bad9774fd39b", hash)
+	}
+}
+
+func Test_ParseConfigStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     string
+		errorMsg string
+	}{
+		{
+			name:     "unknown top level field",
+			fileName: "orch.json",
+			data:     `{"namespace": "orch", "colectors": []}`,
+			errorMsg: `orch.json: unable to unmarshal: json: unknown field "colectors"`,
+		},
+		{
+			name:     "unknown source field",
+			fileName: "orch.json",
+			data:     `{"namespace": "orch", "source": {"queryUri": "http://localhost", "org": "foo"}}`,
+			errorMsg: `orch.json: unable to unmarshal: json: unknown field "org"`,
+		},
+		{
+			name:     "unknown collector field",
+			fileName: "orch.yaml",
+			data:     "namespace: orch\ncollectors:\n  - name: api\n  - name: node\n    enable: true\n",
+			errorMsg: `orch.yaml: collector 1: unable to unmarshal: json: unknown field "enable"`,
+		},
+		{
+			name:     "misspelled metric type",
+			fileName: "orch.json",
+			data:     `{"collectors": [{"name": "api", "metrics": [{"id": "up", "Type": "Gauge"}, {"id": "down", "Typ": "Gauge"}]}]}`,
+			errorMsg: `orch.json: collector 0 ("api") metric 1: unable to unmarshal: json: unknown field "Typ"`,
+		},
+		{
+			name:     "invalid metric field type",
+			fileName: "orch.json",
+			data:     `{"collectors": [{"name": "api", "metrics": [{"id": "up", "queryTimeout": "5 minutes"}]}]}`,
+			errorMsg: `orch.json: collector 0 ("api") metric 0: unable to unmarshal:`,
+		},
+		{
+			name:     "duplicate YAML key",
+			fileName: "orch.yaml",
+			data:     "namespace: orch\nnamespace: node\n",
+			errorMsg: "orch.yaml: invalid YAML:",
+		},
+		{
+			name:     "trailing data",
+			fileName: "orch.json",
+			data:     `{"namespace": "orch"} {}`,
+			errorMsg: "orch.json: unable to unmarshal: unexpected data after the configuration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig(tt.fileName, []byte(tt.data))
+			require.ErrorContains(t, err, tt.errorMsg)
+		})
+	}
+}
+
+func Test_DeployedConfigs(t *testing.T) {
+	configPaths, err := filepath.Glob("../../deployments/sre-exporter/files/configs/sre-exporter-*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, configPaths)
+	for _, configPath := range configPaths {
+		_, _, err := InitConfig(&configPath)
+		require.NoError(t, err, configPath)
+	}
+}
+
+// Test_ConfigurationSchema checks that the published JSON Schema describes exactly the fields of the models.
+func Test_ConfigurationSchema(t *testing.T) {
+	type schemaObject struct {
+		Properties           map[string]json.RawMessage `json:"properties"`
+		AdditionalProperties *bool                      `json:"additionalProperties"`
+	}
+	var schema struct {
+		schemaObject
+		Defs map[string]schemaObject `json:"$defs"`
+	}
+	data, err := os.ReadFile("../../docs/configuration.schema.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &schema))
+
+	jsonFields := func(value any) []string {
+		var fields []string
+		valueType := reflect.TypeOf(value)
+		for i := range valueType.NumField() {
+			name, _, _ := strings.Cut(valueType.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+		}
+		slices.Sort(fields)
+		return fields
+	}
+	objects := map[string]any{
+		"":               models.Configuration{},
+		"source":         models.Source{},
+		"collector":      models.Collector{},
+		"metric":         models.Metric{},
+		"evaluation":     models.Evaluation{},
+		"relabelConfig":  models.RelabelConfig{},
+		"basicAuth":      models.BasicAuth{},
+		"oauth2":         models.OAuth2{},
+		"tls":            models.TLSConfig{},
+		"fallback":       models.Fallback{},
+		"retry":          models.Retry{},
+		"circuitBreaker": models.CircuitBreaker{},
+	}
+	for def, value := range objects {
+		object := schema.schemaObject
+		if def != "" {
+			object = schema.Defs[def]
+		}
+		properties := make([]string, 0, len(object.Properties))
+		for property := range object.Properties {
+			properties = append(properties, property)
+		}
+		slices.Sort(properties)
+		require.Equal(t, jsonFields(value), properties, def)
+		require.NotNil(t, object.AdditionalProperties, def)
+		require.False(t, *object.AdditionalProperties, def)
+	}
+}
+
 const sampleConfig = `
 {
   "namespace": "orch_edgenode",
@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configWatchDebounce is how long the watcher waits for the file events to settle before the files are hashed,
+// a ConfigMap update is made of several events.
+const configWatchDebounce = time.Second
+
+// configWatchRetry is how often the directories which could not be watched, e.g. not mounted yet, are added again.
+const configWatchRetry = 10 * time.Second
+
+// configExtensions are the extensions of the files loaded from a config directory.
+var configExtensions = []string{".json", ".yaml", ".yml"}
+
+// ResolveConfigFiles returns the config files followed by the files matched by the config dirs, without duplicates.
+// A config dir is either a directory, from which the .json, .yaml and .yml files are loaded, or a glob pattern.
+// Hidden files, such as the ..data entries of a mounted ConfigMap, are skipped.
+func ResolveConfigFiles(configFiles, configDirs []string) ([]string, error) {
+	files := slices.Clone(configFiles)
+	for _, configDir := range configDirs {
+		var matches []string
+		if info, err := os.Stat(configDir); err == nil && info.IsDir() {
+			entries, err := os.ReadDir(configDir)
+			if err != nil {
+				return nil, fmt.Errorf("error reading config dir: %w", err)
+			}
+			for _, entry := range entries {
+				if slices.Contains(configExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+					matches = append(matches, filepath.Join(configDir, entry.Name()))
+				}
+			}
+		} else {
+			matches, err = filepath.Glob(configDir)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config dir pattern %q: %w", configDir, err)
+			}
+		}
+
+		for _, match := range matches {
+			if strings.HasPrefix(filepath.Base(match), ".") || slices.Contains(files, match) {
+				continue
+			}
+			// directories and broken links are skipped
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// ConfigWatcher watches the directories of the config files, and of the files referenced by their sources,
+// and reports the files whose configuration changed. The directories are watched rather than the files, so that
+// the ..data symlink swap performed by Kubernetes when a mounted ConfigMap or Secret is updated is detected.
+// A directory which cannot be watched does not prevent watching the other ones, it is added again periodically.
+type ConfigWatcher struct {
+	configFiles []string
+	configDirs  []string
+	debounce    time.Duration
+	retry       time.Duration
+	hashes      map[string]string
+	// unwatched are the directories which could not be watched, their failure is logged once
+	unwatched map[string]bool
+	// referencedFiles are the files referenced by the sources of the config files
+	referencedFiles []string
+	onChange        func(changed []string)
+}
+
+// NewConfigWatcher hashes the current config files, onChange is called with the files added, removed
+// or whose configuration hash changed since then.
+func NewConfigWatcher(configFiles, configDirs []string, onChange func(changed []string)) (*ConfigWatcher, error) {
+	watcher := &ConfigWatcher{
+		configFiles: configFiles,
+		configDirs:  configDirs,
+		debounce:    configWatchDebounce,
+		retry:       configWatchRetry,
+		unwatched:   make(map[string]bool),
+		onChange:    onChange,
+	}
+	hashes, referencedFiles, err := watcher.hashFiles()
+	if err != nil {
+		return nil, err
+	}
+	watcher.hashes = hashes
+	watcher.referencedFiles = referencedFiles
+	return watcher, nil
+}
+
+// Run watches the config directories until the context is done.
+func (watcher *ConfigWatcher) Run(ctx context.Context) error {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	defer fsWatcher.Close()
+	watcher.watchDirs(fsWatcher)
+
+	timer := time.NewTimer(watcher.debounce)
+	timer.Stop()
+	defer timer.Stop()
+	retry := time.NewTicker(watcher.retry)
+	defer retry.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			timer.Reset(watcher.debounce)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Config watcher error: %v", err)
+		case <-retry.C:
+			// the files of a directory watched only now may have changed meanwhile
+			if watcher.watchDirs(fsWatcher) {
+				timer.Reset(watcher.debounce)
+			}
+		case <-timer.C:
+			watcher.rescan()
+			// the sources may reference new files
+			watcher.watchDirs(fsWatcher)
+		}
+	}
+}
+
+// rescan hashes the config files again and reports the changed ones.
+func (watcher *ConfigWatcher) rescan() {
+	hashes, referencedFiles, err := watcher.hashFiles()
+	if err != nil {
+		log.Printf("Failed to rescan config files: %v", err)
+		return
+	}
+	watcher.referencedFiles = referencedFiles
+	var changed []string
+	for file, hash := range hashes {
+		if watcher.hashes[file] != hash {
+			changed = append(changed, file)
+		}
+	}
+	for file := range watcher.hashes {
+		if _, ok := hashes[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	watcher.hashes = hashes
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		log.Printf("Config files changed: %v", changed)
+		watcher.onChange(changed)
+	}
+}
+
+// hashFiles returns the configuration hash of every config file, computed as by InitConfig, along with the files
+// referenced by their sources. Files which cannot be loaded are hashed by their content, so that their changes
+// are reported too.
+func (watcher *ConfigWatcher) hashFiles() (map[string]string, []string, error) {
+	files, err := ResolveConfigFiles(watcher.configFiles, watcher.configDirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make(map[string]string, len(files))
+	var referencedFiles []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			hashes[file] = ""
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hashes[file] = "content:" + hex.EncodeToString(sum[:])
+		if config, err := ParseConfig(file, data); err == nil {
+			if _, hash, sourceFiles, err := expandConfig(file, config); err == nil {
+				hashes[file] = hash
+				referencedFiles = append(referencedFiles, sourceFiles...)
+			}
+		}
+	}
+	return hashes, referencedFiles, nil
+}
+
+// watchDirs adds the directories of the config files, the config dirs and the directories of the referenced files
+// to the watcher. A directory which cannot be watched, or is removed, is added again on the next call. It reports
+// whether a directory was added.
+func (watcher *ConfigWatcher) watchDirs(fsWatcher *fsnotify.Watcher) bool {
+	added := false
+	watched := fsWatcher.WatchList()
+	for _, dir := range watcher.watchedDirs() {
+		if slices.Contains(watched, dir) {
+			continue
+		}
+		if err := fsWatcher.Add(dir); err != nil {
+			if !watcher.unwatched[dir] {
+				log.Printf("Failed to watch dir %q, retrying every %s: %v", dir, watcher.retry, err)
+				watcher.unwatched[dir] = true
+			}
+			continue
+		}
+		log.Printf("Watching dir %q", dir)
+		delete(watcher.unwatched, dir)
+		added = true
+	}
+	return added
+}
+
+// watchedDirs returns the directories of the config files, the config dirs and the directories of the referenced files.
+// A config dir which does not exist yet is returned as is, unless it is a pattern.
+func (watcher *ConfigWatcher) watchedDirs() []string {
+	var dirs []string
+	add := func(dir string) {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, file := range watcher.configFiles {
+		add(filepath.Dir(file))
+	}
+	for _, configDir := range watcher.configDirs {
+		info, err := os.Stat(configDir)
+		if err == nil && info.IsDir() || os.IsNotExist(err) && !strings.ContainsAny(configDir, `*?[\`) {
+			add(configDir)
+			continue
+		}
+		// the directory part of a pattern can be a pattern too
+		matches, err := filepath.Glob(filepath.Dir(configDir))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				add(match)
+			}
+		}
+	}
+	for _, file := range watcher.referencedFiles {
+		add(filepath.Dir(file))
+	}
+	return dirs
+}
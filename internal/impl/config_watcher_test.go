@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, path, namespace string) {
+	t.Helper()
+	config := `{"namespace": "` + namespace + `", "source": {"queryURI": "http://localhost:8181/prometheus"}, "collectors": []}`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+}
+
+func TestResolveConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.yaml", "c.yml", "notes.txt", ".hidden.json"} {
+		writeConfigFile(t, filepath.Join(dir, name), "orch")
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub.json"), 0o750))
+	extra := filepath.Join(t.TempDir(), "extra.json")
+	writeConfigFile(t, extra, "extra")
+
+	files, err := ResolveConfigFiles([]string{extra}, []string{dir})
+	require.NoError(t, err)
+	require.Equal(t, []string{extra, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.yaml"), filepath.Join(dir, "c.yml")}, files)
+
+	files, err = ResolveConfigFiles([]string{filepath.Join(dir, "a.json")}, []string{filepath.Join(dir, "*.json")})
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a.json")}, files)
+
+	_, err = ResolveConfigFiles(nil, []string{filepath.Join(dir, "[")})
+	require.Error(t, err)
+}
+
+// updateConfigMap mimics the update of a mounted ConfigMap: the files are written to a new timestamped
+// directory and the ..data symlink is atomically swapped to it.
+func updateConfigMap(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+	dataDir := filepath.Join(dir, "..2026_"+version)
+	require.NoError(t, os.Mkdir(dataDir, 0o750))
+	for name, namespace := range files {
+		writeConfigFile(t, filepath.Join(dataDir, name), namespace)
+	}
+	require.NoError(t, os.Symlink(filepath.Base(dataDir), filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			require.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	dir := t.TempDir()
+	updateConfigMap(t, dir, "1", map[string]string{"orch.json": "orch", "edge-node.json": "orch_edgenode"})
+
+	changes := make(chan []string, 10)
+	watcher, err := NewConfigWatcher(nil, []string{dir}, func(changed []string) { changes <- changed })
+	require.NoError(t, err)
+	watcher.debounce = 50 * time.Millisecond
+	require.Len(t, watcher.hashes, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		assert.NoError(t, watcher.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	// let the watcher add the directory
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func() []string {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no config change reported")
+			return nil
+		}
+	}
+
+	t.Run("symlink swap", func(t *testing.T) {
+		updateConfigMap(t, dir, "2", map[string]string{"orch.json": "orch", "edge-node.json": "orch_edgenode_v2"})
+		require.Equal(t, []string{filepath.Join(dir, "edge-node.json")}, receive())
+	})
+
+	t.Run("file added and removed", func(t *testing.T) {
+		writeConfigFile(t, filepath.Join(dir, "extra.yaml"), "extra")
+		require.Equal(t, []string{filepath.Join(dir, "extra.yaml")}, receive())
+		require.NoError(t, os.Remove(filepath.Join(dir, "extra.yaml")))
+		require.Equal(t, []string{filepath.Join(dir, "extra.yaml")}, receive())
+	})
+
+	t.Run("unchanged configuration", func(t *testing.T) {
+		updateConfigMap(t, dir, "3", map[string]string{"orch.json": "orch", "edge-node.json": "orch_edgenode_v2"})
+		select {
+		case changed := <-changes:
+			require.FailNow(t, "unexpected config change", "%v", changed)
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+}
+
+func TestConfigWatcherReferencedFiles(t *testing.T) {
+	dir := t.TempDir()
+	secretsDir := t.TempDir()
+	tlsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "org"), []byte("orch-system"), 0o600))
+	configFile := filepath.Join(dir, "orch.json")
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"namespace": "orch", "source": {"queryURI": "https://localhost",
+		"mimirOrg": "file://`+filepath.Join(secretsDir, "org")+`", "tls": {"caFile": "`+filepath.Join(tlsDir, "ca.crt")+`"}}}`), 0o600))
+
+	changes := make(chan []string, 10)
+	watcher, err := NewConfigWatcher([]string{configFile}, nil, func(changed []string) { changes <- changed })
+	require.NoError(t, err)
+	watcher.debounce = 50 * time.Millisecond
+	require.Equal(t, []string{filepath.Join(secretsDir, "org"), filepath.Join(tlsDir, "ca.crt")}, watcher.referencedFiles)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		assert.NoError(t, watcher.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	// let the watcher add the directories
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func() []string {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no config change reported")
+			return nil
+		}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "org"), []byte("orch-system|edgenode"), 0o600))
+	require.Equal(t, []string{configFile}, receive())
+	require.NoError(t, os.WriteFile(filepath.Join(tlsDir, "ca.crt"), []byte("CA"), 0o600))
+	require.Equal(t, []string{configFile}, receive())
+}
+
+func TestConfigWatcherMissingDir(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "orch.json")
+	writeConfigFile(t, configFile, "orch")
+	// the directory is mounted after the watcher is started
+	missingDir := filepath.Join(t.TempDir(), "edge-node")
+
+	changes := make(chan []string, 10)
+	watcher, err := NewConfigWatcher([]string{configFile}, []string{missingDir}, func(changed []string) { changes <- changed })
+	require.NoError(t, err)
+	watcher.debounce = 50 * time.Millisecond
+	watcher.retry = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		assert.NoError(t, watcher.Run(ctx))
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	receive := func() []string {
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no config change reported")
+			return nil
+		}
+	}
+	// the other dirs are watched meanwhile
+	writeConfigFile(t, configFile, "orch_v2")
+	require.Equal(t, []string{configFile}, receive())
+
+	require.NoError(t, os.Mkdir(missingDir, 0o750))
+	writeConfigFile(t, filepath.Join(missingDir, "edge-node.json"), "orch_edgenode")
+	require.Equal(t, []string{filepath.Join(missingDir, "edge-node.json")}, receive())
+}
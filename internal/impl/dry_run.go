@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/metrics"
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// DryRun evaluates the queries of the config files once against their sources and writes the resulting metric
+// families of every pipeline in the text exposition format. The families are preceded by comments reporting
+// the latency, samples, warnings and error of every query. It returns an error when a query failed.
+func DryRun(ctx context.Context, configFiles []string, customer string, out io.Writer) error {
+	configs := make([]*models.Configuration, len(configFiles))
+	for i := range configFiles {
+		config, _, err := InitConfig(&configFiles[i])
+		if err != nil {
+			return fmt.Errorf("failed to initialize config: %w", err)
+		}
+		configs[i] = config
+	}
+	if err := ValidateConfigs(configFiles, configs); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var (
+		queries, failed int
+		errs            []error
+	)
+	for _, config := range configs {
+		traces, err := dryRunPipeline(ctx, config, customer, out)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pipeline %q: %w", config.Namespace, err))
+		}
+		queries += len(traces)
+		for i := range traces {
+			if traces[i].Err != nil {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d queries failed", failed, queries))
+	}
+	return errors.Join(errs...)
+}
+
+// dryRunPipeline evaluates the collectors of the configuration once and writes the report of the pipeline.
+// When the metrics cannot all be gathered, the gathered ones are written before the error is returned.
+func dryRunPipeline(ctx context.Context, config *models.Configuration, customer string, out io.Writer) ([]metrics.QueryTrace, error) {
+	// every query is run once within the dry run instead of in the background
+	for i := range config.Collectors {
+		config.Collectors[i].EvaluationInterval = 0
+	}
+	collectors, err := metrics.BuildCollectorsFromConfig(config, customer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build collectors: %w", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		traces []metrics.QueryTrace
+	)
+	ctx = metrics.WithQueryTrace(ctx, func(trace metrics.QueryTrace) {
+		mu.Lock()
+		traces = append(traces, trace)
+		mu.Unlock()
+	})
+	registry := prometheus.NewRegistry()
+	scrape := newScrape()
+	for _, collector := range collectors {
+		if err := registry.Register(scrape.bind(collector)); err != nil {
+			return nil, err
+		}
+	}
+	families, gatherErr := scrape.gatherer(ctx, registry).Gather()
+
+	// queries of a collector run concurrently, they are reported in a stable order
+	slices.SortFunc(traces, func(a, b metrics.QueryTrace) int {
+		return cmp.Or(cmp.Compare(a.Collector, b.Collector), cmp.Compare(a.MetricID, b.MetricID), cmp.Compare(a.Query, b.Query),
+			cmp.Compare(a.Tenant, b.Tenant))
+	})
+	var report strings.Builder
+	fmt.Fprintf(&report, "# pipeline %s\n", config.Namespace)
+	for i := range traces {
+		writeQueryTrace(&report, &traces[i])
+	}
+	if _, err := io.WriteString(out, report.String()); err != nil {
+		return nil, err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(out, family); err != nil {
+			return nil, err
+		}
+	}
+	if gatherErr != nil {
+		return traces, fmt.Errorf("failed to gather metrics: %w", gatherErr)
+	}
+	return traces, nil
+}
+
+// writeQueryTrace writes the query as comments of the exposition format.
+func writeQueryTrace(report *strings.Builder, trace *metrics.QueryTrace) {
+	target := trace.Collector + "/" + trace.MetricID
+	if trace.Tenant != "" {
+		target += " tenant " + trace.Tenant
+	}
+	fmt.Fprintf(report, "# query %s took %s, %d samples: %s\n", target,
+		trace.Latency.Round(10*time.Microsecond), trace.Samples, strings.Join(strings.Fields(trace.Query), " "))
+	if trace.Retries > 0 {
+		fmt.Fprintf(report, "#   retries: %d\n", trace.Retries)
+	}
+	for _, warning := range trace.Warnings {
+		fmt.Fprintf(report, "#   warning: %s\n", warning)
+	}
+	if trace.Err != nil {
+		fmt.Fprintf(report, "#   error: %s\n", strings.Join(strings.Fields(trace.Err.Error()), " "))
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.NoError(t, req.ParseForm())
+		var err error
+		switch req.Form.Get("query") {
+		case "cores":
+			_, err = rw.Write([]byte(`{"status":"success","data":{"resultType":"vector",` +
+				`"result":[{"metric":{"node":"node-1"},"value":[1700000000,"4"]}]},"warnings":["partial response"]}`))
+		case "duplicate":
+			// the series have the same node label, the only one exported
+			_, err = rw.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"node":"node-1","pod":"a"},"value":[1700000000,"1"]},{"metric":{"node":"node-1","pod":"b"},"value":[1700000000,"2"]}]}}`))
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+			_, err = rw.Write([]byte(`{"status":"error","errorType":"bad_data","error":"unknown metric"}`))
+		}
+		assert.NoError(t, err)
+	}))
+	defer mockServer.Close()
+
+	configFile := filepath.Join(t.TempDir(), "orch.yaml")
+	writeDryRunConfig := func(queries ...string) {
+		var metrics strings.Builder
+		for i, query := range queries {
+			metrics.WriteString("      - id: gauge_" + string(rune('a'+i)) + "\n        Type: Gauge\n        labels: [node]\n")
+			metrics.WriteString("        query: " + query + "\n")
+		}
+		config := "namespace: orch\nsource:\n  queryURI: " + mockServer.URL + "\n" +
+			"collectors:\n  - name: node\n    enabled: true\n    evaluationInterval: 1m\n    metrics:\n" + metrics.String()
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0o600))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		writeDryRunConfig("cores")
+		var out bytes.Buffer
+		require.NoError(t, DryRun(context.Background(), []string{configFile}, "customer", &out))
+
+		output := out.String()
+		require.True(t, strings.HasPrefix(output, "# pipeline orch\n# query node/gauge_a took "), output)
+		require.Contains(t, output, ", 1 samples: cores\n#   warning: partial response\n")
+
+		parser := expfmt.NewTextParser(model.LegacyValidation)
+		families, err := parser.TextToMetricFamilies(&out)
+		require.NoError(t, err)
+		require.Contains(t, families, "orch_node_gauge_a")
+		require.InDelta(t, 4, families["orch_node_gauge_a"].GetMetric()[0].GetGauge().GetValue(), 0)
+		require.InDelta(t, 1, families["orch_node_warnings"].GetMetric()[0].GetGauge().GetValue(), 0)
+	})
+
+	t.Run("failed query", func(t *testing.T) {
+		writeDryRunConfig("cores", "unknown")
+		var out bytes.Buffer
+		err := DryRun(context.Background(), []string{configFile}, "customer", &out)
+		require.EqualError(t, err, "1 of 2 queries failed")
+		require.Contains(t, out.String(), ", 0 samples: unknown\n#   error: bad_data: unknown metric\n")
+		require.Contains(t, out.String(), "orch_node_metric_error{customer=\"customer\",metric=\"gauge_b\",reason=\"bad_data\",service=\"orch\"} 1\n")
+	})
+
+	t.Run("gather error", func(t *testing.T) {
+		writeDryRunConfig("cores", "duplicate")
+		var out bytes.Buffer
+		err := DryRun(context.Background(), []string{configFile}, "customer", &out)
+		require.ErrorContains(t, err, `pipeline "orch": failed to gather metrics: `)
+		// the metrics gathered are written nevertheless
+		require.Contains(t, out.String(), "orch_node_gauge_a{customer=\"customer\",node=\"node-1\",service=\"orch\"} 4\n")
+		require.Contains(t, out.String(), "orch_node_up{customer=\"customer\",service=\"orch\"} 1\n")
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		writeDryRunConfig("sum(")
+		var out bytes.Buffer
+		require.ErrorContains(t, DryRun(context.Background(), []string{configFile}, "customer", &out), "invalid config")
+		require.Empty(t, out.String())
+	})
+}
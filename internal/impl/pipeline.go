@@ -4,34 +4,94 @@
 package impl
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// backgroundCollector is implemented by collectors which evaluate their metrics in the background.
+type backgroundCollector interface {
+	Start()
+	Stop()
+}
+
+// contextCollector is implemented by collectors which bind their queries to the context of the scrape.
+type contextCollector interface {
+	CollectWithContext(ctx context.Context, metrics chan<- prometheus.Metric)
+}
+
+const (
+	// scrapeTimeoutHeader is set by Prometheus to the scrape timeout of the target.
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+	// scrapeTimeoutOffset leaves time to send the response before the scraper gives up.
+	scrapeTimeoutOffset = 500 * time.Millisecond
 )
 
 type Pipeline struct {
-	registry   *prometheus.Registry
-	collectors []prometheus.Collector
-	namespace  string
+	// registry holds the collectors wrapped as scrapeCollectors bound to the scrape gathering it
+	registry *prometheus.Registry
+	scrape   *scrape
+	// handlerRegistry holds the metrics of the endpoint handler itself
+	handlerRegistry *prometheus.Registry
+	mu              sync.Mutex
+	collectors      []prometheus.Collector
+	namespace       string
 }
 
 // Namespace must be unique for every pipeline.
 func NewPipeline(namespace string) *Pipeline {
 	return &Pipeline{
-		registry:  prometheus.NewRegistry(),
-		namespace: namespace,
+		registry:        prometheus.NewRegistry(),
+		scrape:          newScrape(),
+		handlerRegistry: prometheus.NewRegistry(),
+		namespace:       namespace,
 	}
 }
 
+// AddCollectors registers the collectors and starts the background ones.
 func (pipeline *Pipeline) AddCollectors(collectors ...prometheus.Collector) {
-	pipeline.registry.MustRegister(collectors...)
+	pipeline.mu.Lock()
+	for _, collector := range collectors {
+		pipeline.registry.MustRegister(pipeline.scrape.bind(collector))
+	}
 	pipeline.collectors = append(pipeline.collectors, collectors...)
+	pipeline.mu.Unlock()
+	startCollectors(collectors)
+}
+
+// ReplaceCollectors replaces all the collectors of the pipeline, the endpoint serves the new ones from the next scrape.
+// The pipeline is left unchanged when the new collectors cannot be registered together.
+func (pipeline *Pipeline) ReplaceCollectors(collectors ...prometheus.Collector) error {
+	registry := prometheus.NewRegistry()
+	for _, collector := range collectors {
+		if err := registry.Register(pipeline.scrape.bind(collector)); err != nil {
+			return fmt.Errorf("could not register collector: %w", err)
+		}
+	}
+
+	pipeline.mu.Lock()
+	previous := pipeline.collectors
+	pipeline.registry = registry
+	pipeline.collectors = collectors
+	pipeline.mu.Unlock()
+
+	stopCollectors(previous)
+	startCollectors(collectors)
+	return nil
 }
 
 func (pipeline *Pipeline) UnregisterCollectors() error {
+	pipeline.mu.Lock()
+	defer pipeline.mu.Unlock()
 	for _, collector := range pipeline.collectors {
+		stopCollectors([]prometheus.Collector{collector})
 		if ok := pipeline.registry.Unregister(collector); !ok {
 			return fmt.Errorf("could not unregister collector: '%v'", collector)
 		}
@@ -40,10 +100,101 @@ func (pipeline *Pipeline) UnregisterCollectors() error {
 	return nil
 }
 
+// GetEndpointHandler returns the handler gathering the pipeline metrics. Queries of every scrape are cancelled
+// when the scrape request is cancelled or its timeout, if sent by the scraper, is exceeded. Concurrent scrapes
+// of the pipeline are served one at a time.
 func (pipeline *Pipeline) GetEndpointHandler() http.Handler {
-	return promhttp.HandlerFor(pipeline.registry, promhttp.HandlerOpts{Registry: pipeline.registry})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := scrapeContext(req)
+		defer cancel()
+
+		pipeline.mu.Lock()
+		registry := pipeline.registry
+		pipeline.mu.Unlock()
+
+		gatherers := prometheus.Gatherers{pipeline.scrape.gatherer(ctx, registry), pipeline.handlerRegistry}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{Registry: pipeline.handlerRegistry}).ServeHTTP(w, req)
+	})
 }
 
 func (pipeline *Pipeline) GetNamespace() string {
 	return pipeline.namespace
 }
+
+func startCollectors(collectors []prometheus.Collector) {
+	for _, collector := range collectors {
+		if bgCollector, ok := collector.(backgroundCollector); ok {
+			bgCollector.Start()
+		}
+	}
+}
+
+func stopCollectors(collectors []prometheus.Collector) {
+	for _, collector := range collectors {
+		if bgCollector, ok := collector.(backgroundCollector); ok {
+			bgCollector.Stop()
+		}
+	}
+}
+
+// scrapeContext returns the context of the scrape request limited by the timeout sent by the scraper.
+func scrapeContext(req *http.Request) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(req.Header.Get(scrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(req.Context())
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(req.Context(), timeout)
+}
+
+// scrape holds the context of the scrape gathering a registry of scrapeCollectors, so that the collectors are
+// registered once and bound to the context of every scrape. The scrapes are serialized by the token,
+// the context is only set while it is held.
+type scrape struct {
+	token chan struct{}
+	ctx   context.Context
+}
+
+func newScrape() *scrape {
+	return &scrape{token: make(chan struct{}, 1), ctx: context.Background()}
+}
+
+// bind returns the collector bound to the context of the scrapes.
+func (s *scrape) bind(collector prometheus.Collector) prometheus.Collector {
+	return &scrapeCollector{Collector: collector, scrape: s}
+}
+
+// gatherer returns the gatherer of the registry whose collectors are bound to the context. It waits for the scrape
+// in progress, if any, and gives up when the context is done meanwhile.
+func (s *scrape) gatherer(ctx context.Context, registry prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		select {
+		case s.token <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("scrape in progress: %w", ctx.Err())
+		}
+		defer func() {
+			s.ctx = context.Background()
+			<-s.token
+		}()
+		s.ctx = ctx
+		return registry.Gather()
+	})
+}
+
+// scrapeCollector binds the collector to the context of the scrape gathering it.
+type scrapeCollector struct {
+	prometheus.Collector
+	scrape *scrape
+}
+
+func (collector *scrapeCollector) Collect(metrics chan<- prometheus.Metric) {
+	if ctxCollector, ok := collector.Collector.(contextCollector); ok {
+		ctxCollector.CollectWithContext(collector.scrape.ctx, metrics)
+		return
+	}
+	collector.Collector.Collect(metrics)
+}
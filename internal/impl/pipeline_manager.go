@@ -5,15 +5,19 @@ package impl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type routerSwapper struct {
@@ -37,13 +41,19 @@ func (rs *routerSwapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type PipelineManager struct {
 	routerSwapper *routerSwapper
 	server        *http.Server
-	pipelines     []*Pipeline
+	// pipelines are served by their endpoints, they can be changed while the router is serving
+	pipelineMu sync.RWMutex
+	pipelines  []*Pipeline
+	endpoints  map[string]*Pipeline
+	// configHashes holds the hash of the configuration of every configured namespace
+	hashMu       sync.Mutex
+	configHashes map[string]string
+	// exporterRegistry holds the metrics of the exporter itself
+	exporterRegistry *prometheus.Registry
 }
 
 func NewPipelineManager(listenAddress *string) *PipelineManager {
 	swapper := &routerSwapper{}
-	swapper.Swap(mux.NewRouter())
-
 	server := &http.Server{
 		Addr:         *listenAddress,
 		ReadTimeout:  5 * time.Second,
@@ -52,19 +62,57 @@ func NewPipelineManager(listenAddress *string) *PipelineManager {
 		Handler:      swapper,
 	}
 
-	return &PipelineManager{
-		routerSwapper: swapper,
-		server:        server,
+	manager := &PipelineManager{
+		routerSwapper:    swapper,
+		server:           server,
+		endpoints:        make(map[string]*Pipeline),
+		exporterRegistry: prometheus.NewRegistry(),
 	}
+	swapper.Swap(manager.newRouter())
+	return manager
+}
+
+// newRouter returns a router serving the registered pipelines, their endpoints are looked up on every request.
+func (manager *PipelineManager) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.MatcherFunc(func(req *http.Request, _ *mux.RouteMatch) bool {
+		return manager.endpointPipeline(req.URL.Path) != nil
+	}).HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		pipeline := manager.endpointPipeline(req.URL.Path)
+		if pipeline == nil {
+			// the pipeline was unregistered after the request was matched
+			http.NotFound(w, req)
+			return
+		}
+		pipeline.GetEndpointHandler().ServeHTTP(w, req)
+	})
+	return router
+}
+
+func (manager *PipelineManager) endpointPipeline(endpoint string) *Pipeline {
+	manager.pipelineMu.RLock()
+	defer manager.pipelineMu.RUnlock()
+	return manager.endpoints[endpoint]
 }
 
+// RegisterPipeline serves the pipeline on the endpoint, replacing the pipeline previously registered on it.
 func (manager *PipelineManager) RegisterPipeline(endpoint string, pipeline *Pipeline) {
-	manager.routerSwapper.router.Handle(endpoint, pipeline.GetEndpointHandler())
-	log.Printf("endpoint %q registered", endpoint)
+	manager.pipelineMu.Lock()
+	if previous, ok := manager.endpoints[endpoint]; ok {
+		manager.pipelines = slices.DeleteFunc(manager.pipelines, func(p *Pipeline) bool { return p == previous })
+	}
+	manager.endpoints[endpoint] = pipeline
 	manager.pipelines = append(manager.pipelines, pipeline)
+	manager.pipelineMu.Unlock()
+	log.Printf("endpoint %q registered", endpoint)
 }
 
-func (manager *PipelineManager) RegisterReload(endpoint string, done chan os.Signal) {
+// RegisterReload registers the endpoint reloading the configuration. It responds once the new pipelines are served
+// with the status of the reload, with an error status code when it failed. With the async query parameter set
+// to true it responds immediately with the ID of the reload. The history of the last reloads is served
+// on the status subpath.
+func (manager *PipelineManager) RegisterReload(endpoint string, reloader *Reloader) {
+	manager.exporterRegistry.MustRegister(reloader.collectors()...)
 	manager.routerSwapper.router.HandleFunc(endpoint, func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != http.MethodPost {
 			log.Printf("Received %v request on %v endpoint", req.Method, endpoint)
@@ -72,21 +120,89 @@ func (manager *PipelineManager) RegisterReload(endpoint string, done chan os.Sig
 			return
 		}
 
-		log.Print("Received hot reload request. Reinitializing pipeline manager...")
-		if err := manager.CleanUp(); err != nil {
-			log.Printf("Failed to clean up pipeline manager: %v", err)
-			http.Error(w, "Request failed", http.StatusInternalServerError)
-			// hot reload impossible, so we need to restart the process
-			done <- syscall.SIGTERM
+		if async, err := strconv.ParseBool(req.URL.Query().Get("async")); err == nil && async {
+			id := reloader.ReloadAsync(ReloadTriggerHTTP)
+			log.Printf("Received hot reload request. Reload %d started", id)
+			writeJSON(w, http.StatusAccepted, struct {
+				ID uint64 `json:"id"`
+			}{ID: id})
 			return
 		}
-		w.WriteHeader(http.StatusOK)
-		done <- syscall.SIGHUP
+
+		log.Print("Received hot reload request. Reloading changed pipelines...")
+		status := reloader.Reload(ReloadTriggerHTTP)
+		code := http.StatusOK
+		if !status.Success {
+			code = http.StatusInternalServerError
+		}
+		writeJSON(w, code, status)
 	})
 	log.Printf("endpoint %q registered", endpoint)
+
+	statusEndpoint := endpoint + "/status"
+	manager.routerSwapper.router.HandleFunc(statusEndpoint, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Bad request", http.StatusMethodNotAllowed)
+			return
+		}
+		history := reloader.History()
+		var lastReload *ReloadStatus
+		if len(history) > 0 {
+			lastReload = history[0]
+		}
+		writeJSON(w, http.StatusOK, struct {
+			LastReload *ReloadStatus   `json:"lastReload"`
+			Reloads    []*ReloadStatus `json:"reloads"`
+		}{LastReload: lastReload, Reloads: history})
+	})
+	log.Printf("endpoint %q registered", statusEndpoint)
 }
 
-func (manager *PipelineManager) RegisterConfigHash(endpoint string, hash string) {
+// RegisterExporterMetrics registers the endpoint serving the metrics of the exporter itself.
+func (manager *PipelineManager) RegisterExporterMetrics(endpoint string) {
+	manager.routerSwapper.router.Handle(endpoint, promhttp.HandlerFor(manager.exporterRegistry, promhttp.HandlerOpts{}))
+	log.Printf("endpoint %q registered", endpoint)
+}
+
+// Pipeline returns the registered pipeline of the namespace, or nil.
+func (manager *PipelineManager) Pipeline(namespace string) *Pipeline {
+	manager.pipelineMu.RLock()
+	defer manager.pipelineMu.RUnlock()
+	for _, pipeline := range manager.pipelines {
+		if pipeline.GetNamespace() == namespace {
+			return pipeline
+		}
+	}
+	return nil
+}
+
+// SetConfigHashes sets the configuration hashes of all the configured namespaces.
+func (manager *PipelineManager) SetConfigHashes(hashes map[string]string) {
+	manager.hashMu.Lock()
+	manager.configHashes = maps.Clone(hashes)
+	manager.hashMu.Unlock()
+}
+
+// SetConfigHash updates the configuration hash of the namespace.
+func (manager *PipelineManager) SetConfigHash(namespace, hash string) {
+	manager.hashMu.Lock()
+	if manager.configHashes == nil {
+		manager.configHashes = make(map[string]string)
+	}
+	manager.configHashes[namespace] = hash
+	manager.hashMu.Unlock()
+}
+
+// ConfigHashes returns the configuration hashes of the configured namespaces.
+func (manager *PipelineManager) ConfigHashes() map[string]string {
+	manager.hashMu.Lock()
+	defer manager.hashMu.Unlock()
+	return maps.Clone(manager.configHashes)
+}
+
+// RegisterConfigHash registers the endpoint responding with the JSON map of the configuration hashes
+// by namespace, and the endpoint of each namespace under it responding with its hash.
+func (manager *PipelineManager) RegisterConfigHash(endpoint string) {
 	manager.routerSwapper.router.HandleFunc(endpoint, func(w http.ResponseWriter, req *http.Request) {
 		log.Printf("Received %v request on %q endpoint", req.Method, endpoint)
 		if req.Method != http.MethodGet {
@@ -94,14 +210,32 @@ func (manager *PipelineManager) RegisterConfigHash(endpoint string, hash string)
 			return
 		}
 
-		log.Printf("Responding with hash: %s", hash)
+		writeJSON(w, http.StatusOK, manager.ConfigHashes())
+	})
+	log.Printf("endpoint %q registered", endpoint)
+
+	namespaceEndpoint := endpoint + "/{namespace}"
+	manager.routerSwapper.router.HandleFunc(namespaceEndpoint, func(w http.ResponseWriter, req *http.Request) {
+		log.Printf("Received %v request on %q endpoint", req.Method, req.URL.Path)
+		if req.Method != http.MethodGet {
+			http.Error(w, "Bad request", http.StatusMethodNotAllowed)
+			return
+		}
+
+		namespace := mux.Vars(req)["namespace"]
+		hash, ok := manager.ConfigHashes()[namespace]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Namespace %q is not configured", namespace), http.StatusNotFound)
+			return
+		}
+		log.Printf("Responding with hash of namespace %q: %s", namespace, hash)
 		w.WriteHeader(http.StatusOK)
 		_, err := w.Write([]byte(hash))
 		if err != nil {
 			log.Print(err.Error())
 		}
 	})
-	log.Printf("endpoint %q registered", endpoint)
+	log.Printf("endpoint %q registered", namespaceEndpoint)
 }
 
 // RegisterHealthCheck registers the health check endpoint.
@@ -127,16 +261,10 @@ func (manager *PipelineManager) Close() error {
 	return manager.server.Close()
 }
 
-// CleanUp unregisters collectors for each pipeline, removes all pipelines, and swaps a new router.
-func (manager *PipelineManager) CleanUp() error {
-	for _, pipeline := range manager.pipelines {
-		err := pipeline.UnregisterCollectors()
-		if err != nil {
-			return fmt.Errorf("could not clear pipeline '%v', error: %w", pipeline, err)
-		}
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err.Error())
 	}
-	manager.routerSwapper.Swap(mux.NewRouter())
-	manager.pipelines = nil
-
-	return nil
 }
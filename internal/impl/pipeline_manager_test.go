@@ -4,13 +4,19 @@
 package impl
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
 )
 
 func TestRegisterPipeline(t *testing.T) {
@@ -40,3 +46,296 @@ func TestStart(t *testing.T) {
 	manager.routerSwapper.router.ServeHTTP(w, req)
 	require.Equal(t, "OK", w.Body.String())
 }
+
+func TestUpdatePipelines(t *testing.T) {
+	listenAddress := ":45567"
+	manager := NewPipelineManager(&listenAddress)
+	vault := NewPipeline("vault")
+	manager.RegisterPipeline(PipelineEndpoint("vault"), vault)
+
+	newConfig := func(namespace, metricID string) *models.Configuration {
+		return &models.Configuration{
+			Namespace: namespace,
+			Source:    models.Source{URI: "http://127.0.0.1:1/prometheus"},
+			Collectors: []models.Collector{{
+				Name:    "api",
+				Enabled: true,
+				Metrics: []models.Metric{{ID: metricID, Query: "up", Type: models.MetricTypeGauge}},
+			}},
+		}
+	}
+	scrape := func(endpoint string) (int, string) {
+		w := httptest.NewRecorder()
+		manager.routerSwapper.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint, nil))
+		return w.Code, w.Body.String()
+	}
+
+	err := manager.UpdatePipelines(
+		[]*models.Configuration{newConfig("orch", "up"), newConfig("orch_edgenode", "up")},
+		map[string]string{"orch": "1", "orch_edgenode": "1"}, "customer")
+	require.NoError(t, err)
+	orch := manager.Pipeline("orch")
+	edgeNode := manager.Pipeline("orch_edgenode")
+	require.NotNil(t, orch)
+	require.NotNil(t, edgeNode)
+	orchCollectors := orch.collectors
+	code, body := scrape("/orch_edgenode/metrics")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `metric="up"`)
+
+	t.Run("changed namespace", func(t *testing.T) {
+		err := manager.UpdatePipelines(
+			[]*models.Configuration{newConfig("orch", "up"), newConfig("orch_edgenode", "changed")},
+			map[string]string{"orch": "1", "orch_edgenode": "2"}, "customer")
+		require.NoError(t, err)
+		// the pipeline of the unchanged namespace is untouched
+		require.Same(t, orch, manager.Pipeline("orch"))
+		require.Equal(t, orchCollectors, orch.collectors)
+		// the pipeline of the changed namespace is swapped with a new one
+		require.NotSame(t, edgeNode, manager.Pipeline("orch_edgenode"))
+		require.Empty(t, edgeNode.collectors)
+		_, body := scrape("/orch_edgenode/metrics")
+		require.Contains(t, body, `metric="changed"`)
+		require.Equal(t, map[string]string{"orch": "1", "orch_edgenode": "2"}, manager.ConfigHashes())
+	})
+
+	t.Run("added and removed namespaces", func(t *testing.T) {
+		err := manager.UpdatePipelines(
+			[]*models.Configuration{newConfig("orch", "up"), newConfig("orch_cluster", "up")},
+			map[string]string{"orch": "1", "orch_cluster": "1"}, "customer")
+		require.NoError(t, err)
+		require.Same(t, orch, manager.Pipeline("orch"))
+		require.Nil(t, manager.Pipeline("orch_edgenode"))
+		require.NotNil(t, manager.Pipeline("orch_cluster"))
+		require.Same(t, vault, manager.Pipeline("vault"))
+
+		code, _ := scrape("/orch_edgenode/metrics")
+		require.Equal(t, http.StatusNotFound, code)
+		code, _ = scrape("/orch_cluster/metrics")
+		require.Equal(t, http.StatusOK, code)
+		code, _ = scrape("/vault/metrics")
+		require.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("invalid collectors", func(t *testing.T) {
+		invalid := newConfig("orch", "up")
+		invalid.Collectors[0].Metrics[0].StaticLabels = map[string]string{"service": "foo"}
+		err := manager.UpdatePipelines([]*models.Configuration{invalid}, map[string]string{"orch": "2"}, "customer")
+		require.Error(t, err)
+		require.Same(t, orch, manager.Pipeline("orch"))
+		require.Equal(t, orchCollectors, orch.collectors)
+		require.NotNil(t, manager.Pipeline("orch_cluster"))
+		require.Equal(t, map[string]string{"orch": "1", "orch_cluster": "1"}, manager.ConfigHashes())
+	})
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, "orch.json"), "orch")
+	writeConfigFile(t, filepath.Join(dir, "edge-node.json"), "orch_edgenode")
+
+	listenAddress := ":45568"
+	manager := NewPipelineManager(&listenAddress)
+	reloader := NewReloader(manager, nil, []string{dir}, "customer")
+	require.True(t, reloader.Reload(ReloadTriggerStartup).Success)
+	manager.RegisterReload("/reload", reloader)
+	manager.RegisterExporterMetrics("/exporter/metrics")
+
+	request := func(method, endpoint string) (int, string) {
+		w := httptest.NewRecorder()
+		manager.routerSwapper.ServeHTTP(w, httptest.NewRequest(method, endpoint, nil))
+		return w.Code, w.Body.String()
+	}
+	reloadStatus := func() (*ReloadStatus, []*ReloadStatus) {
+		code, body := request(http.MethodGet, "/reload/status")
+		require.Equal(t, http.StatusOK, code)
+		var status struct {
+			LastReload *ReloadStatus   `json:"lastReload"`
+			Reloads    []*ReloadStatus `json:"reloads"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return status.LastReload, status.Reloads
+	}
+	lastReload := func() *ReloadStatus {
+		status, _ := reloadStatus()
+		return status
+	}
+
+	orch := manager.Pipeline("orch")
+	hashes := manager.ConfigHashes()
+	require.Len(t, hashes, 2)
+
+	t.Run("invalid config", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "edge-node.json"), []byte(`{"namespace": "orch"}`), 0o600))
+		code, body := request(http.MethodPost, "/reload")
+		require.Equal(t, http.StatusInternalServerError, code)
+		var response ReloadStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &response))
+		require.Equal(t, uint64(2), response.ID)
+		require.Contains(t, response.Error, "invalid config")
+
+		// the previous pipelines keep serving
+		require.Same(t, orch, manager.Pipeline("orch"))
+		require.NotNil(t, manager.Pipeline("orch_edgenode"))
+		require.Equal(t, hashes, manager.ConfigHashes())
+		code, _ = request(http.MethodGet, "/orch_edgenode/metrics")
+		require.Equal(t, http.StatusOK, code)
+
+		status := lastReload()
+		require.Equal(t, uint64(2), status.ID)
+		require.Equal(t, ReloadTriggerHTTP, status.Trigger)
+		require.False(t, status.Success)
+		require.Contains(t, status.Error, `namespace "orch" is already used`)
+		require.Equal(t, hashes, status.ConfigHashes)
+		_, body = request(http.MethodGet, "/exporter/metrics")
+		require.Contains(t, body, "sre_exporter_config_reload_failures_total 1\n")
+		require.Contains(t, body, `sre_exporter_config_reloads_total{result="failure",trigger="http"} 1`+"\n")
+		require.Contains(t, body, `sre_exporter_config_reloads_total{result="success",trigger="startup"} 1`+"\n")
+	})
+
+	t.Run("fixed config", func(t *testing.T) {
+		writeConfigFile(t, filepath.Join(dir, "edge-node.json"), "orch_edgenode_v2")
+		code, _ := request(http.MethodPost, "/reload")
+		require.Equal(t, http.StatusOK, code)
+
+		require.Same(t, orch, manager.Pipeline("orch"))
+		require.Nil(t, manager.Pipeline("orch_edgenode"))
+		require.NotNil(t, manager.Pipeline("orch_edgenode_v2"))
+		status := lastReload()
+		require.True(t, status.Success)
+		require.Empty(t, status.Error)
+		require.Equal(t, manager.ConfigHashes(), status.ConfigHashes)
+		require.Contains(t, status.ConfigHashes, "orch_edgenode_v2")
+	})
+
+	t.Run("async", func(t *testing.T) {
+		code, body := request(http.MethodPost, "/reload?async=true")
+		require.Equal(t, http.StatusAccepted, code)
+		require.JSONEq(t, `{"id": 4}`, body)
+
+		require.Eventually(t, func() bool {
+			status := lastReload()
+			return status.ID == 4 && status.Success
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		_, reloads := reloadStatus()
+		require.Len(t, reloads, 4)
+		for i, trigger := range []string{ReloadTriggerHTTP, ReloadTriggerHTTP, ReloadTriggerHTTP, ReloadTriggerStartup} {
+			require.Equal(t, uint64(4-i), reloads[i].ID)
+			require.Equal(t, trigger, reloads[i].Trigger)
+		}
+
+		for range reloadHistorySize {
+			require.True(t, reloader.Reload(ReloadTriggerWatch).Success)
+		}
+		_, reloads = reloadStatus()
+		require.Len(t, reloads, reloadHistorySize)
+		require.Equal(t, uint64(4+reloadHistorySize), reloads[0].ID)
+		require.Equal(t, uint64(5), reloads[reloadHistorySize-1].ID)
+
+		_, body := request(http.MethodGet, "/exporter/metrics")
+		require.Contains(t, body, "sre_exporter_config_reloads_total{result=\"success\",trigger=\"watch\"} 10\n")
+		require.Contains(t, body, "sre_exporter_config_last_reload_success_timestamp_seconds ")
+	})
+
+	t.Run("concurrent async", func(t *testing.T) {
+		ids := make(chan uint64, reloadHistorySize)
+		for range reloadHistorySize {
+			go func() { ids <- reloader.ReloadAsync(ReloadTriggerHTTP) }()
+		}
+		var lastID uint64
+		for range reloadHistorySize {
+			lastID = max(lastID, <-ids)
+		}
+		require.Eventually(t, func() bool { return lastReload().ID == lastID }, 5*time.Second, 10*time.Millisecond)
+		// the reloads complete in the order of their IDs
+		_, reloads := reloadStatus()
+		require.Len(t, reloads, reloadHistorySize)
+		for i, status := range reloads {
+			require.Equal(t, lastID-uint64(i), status.ID)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		code, _ := request(http.MethodGet, "/reload")
+		require.Equal(t, http.StatusMethodNotAllowed, code)
+		code, _ = request(http.MethodPost, "/reload/status")
+		require.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+}
+
+func TestReloaderSlowAndPanickingReloads(t *testing.T) {
+	listenAddress := ":45570"
+	reloader := NewReloader(NewPipelineManager(&listenAddress), nil, nil, "customer")
+	release := make(chan struct{})
+	var loads atomic.Int32
+	reloader.load = func() error {
+		loads.Add(1)
+		<-release
+		return nil
+	}
+
+	done := make(chan *ReloadStatus)
+	go func() { done <- reloader.Reload(ReloadTriggerHTTP) }()
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	// the reloads requested meanwhile are coalesced into a single queued reload
+	for i := range 5 {
+		require.Equal(t, uint64(i+2), reloader.ReloadAsync(ReloadTriggerWatch))
+	}
+	// the history is served while the reload runs
+	require.Nil(t, reloader.LastStatus())
+	close(release)
+	require.True(t, (<-done).Success)
+	require.Eventually(t, func() bool {
+		status := reloader.LastStatus()
+		return status != nil && status.ID == 6
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), loads.Load())
+	history := reloader.History()
+	require.Len(t, history, 6)
+	for i, status := range history {
+		require.Equal(t, uint64(6-i), status.ID)
+		require.True(t, status.Success)
+	}
+
+	reloader.load = func() error { panic("broken") }
+	status := reloader.Reload(ReloadTriggerHTTP)
+	require.False(t, status.Success)
+	require.Equal(t, "reload panicked: broken", status.Error)
+	// the reloads following the panicking one are performed
+	reloader.load = func() error { return nil }
+	status = reloader.Reload(ReloadTriggerHTTP)
+	require.Equal(t, uint64(8), status.ID)
+	require.True(t, status.Success)
+}
+
+func TestRegisterConfigHash(t *testing.T) {
+	listenAddress := ":45569"
+	manager := NewPipelineManager(&listenAddress)
+	manager.SetConfigHashes(map[string]string{"orch": "1", "orch_edgenode": "2"})
+	manager.RegisterConfigHash("/confighash")
+
+	request := func(method, endpoint string) (int, string) {
+		w := httptest.NewRecorder()
+		manager.routerSwapper.ServeHTTP(w, httptest.NewRequest(method, endpoint, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := request(http.MethodGet, "/confighash")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"orch": "1", "orch_edgenode": "2"}`, body)
+
+	code, body = request(http.MethodGet, "/confighash/orch_edgenode")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "2", body)
+
+	code, _ = request(http.MethodGet, "/confighash/orch_cluster")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = request(http.MethodPost, "/confighash")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+	code, _ = request(http.MethodPost, "/confighash/orch")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
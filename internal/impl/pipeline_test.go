@@ -4,12 +4,17 @@
 package impl
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -31,3 +36,122 @@ func TestPipeline_GetEndpointHandler(t *testing.T) {
 	handler.ServeHTTP(responseRecorder, request)
 	require.Equal(t, http.StatusOK, responseRecorder.Code)
 }
+
+type backgroundCollectorMock struct {
+	prometheus.Collector
+	started bool
+	stopped bool
+}
+
+func (c *backgroundCollectorMock) Start() {
+	c.started = true
+}
+
+func (c *backgroundCollectorMock) Stop() {
+	c.stopped = true
+}
+
+func TestPipeline_BackgroundCollectors(t *testing.T) {
+	pipeline := NewPipeline("foo")
+	collector := &backgroundCollectorMock{Collector: collectors.NewGoCollector()}
+
+	pipeline.AddCollectors(collector)
+	require.True(t, collector.started)
+	require.False(t, collector.stopped)
+
+	require.NoError(t, pipeline.UnregisterCollectors())
+	require.True(t, collector.stopped)
+}
+
+func TestPipeline_ReplaceCollectors(t *testing.T) {
+	pipeline := NewPipeline("foo")
+	previous := &backgroundCollectorMock{Collector: collectors.NewGoCollector()}
+	pipeline.AddCollectors(previous)
+
+	// colliding collectors leave the pipeline unchanged
+	err := pipeline.ReplaceCollectors(collectors.NewBuildInfoCollector(), collectors.NewBuildInfoCollector())
+	require.Error(t, err)
+	require.Equal(t, []prometheus.Collector{previous}, pipeline.collectors)
+	require.False(t, previous.stopped)
+
+	replacement := &backgroundCollectorMock{Collector: collectors.NewBuildInfoCollector()}
+	require.NoError(t, pipeline.ReplaceCollectors(replacement))
+	require.Equal(t, []prometheus.Collector{replacement}, pipeline.collectors)
+	require.True(t, previous.stopped)
+	require.True(t, replacement.started)
+
+	responseRecorder := httptest.NewRecorder()
+	pipeline.GetEndpointHandler().ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	require.Contains(t, responseRecorder.Body.String(), "go_build_info")
+	require.NotContains(t, responseRecorder.Body.String(), "go_goroutines")
+
+	require.NoError(t, pipeline.UnregisterCollectors())
+	require.True(t, replacement.stopped)
+}
+
+type contextCollectorMock struct {
+	prometheus.Collector
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (c *contextCollectorMock) CollectWithContext(ctx context.Context, metrics chan<- prometheus.Metric) {
+	c.deadline, c.hasDeadline = ctx.Deadline()
+	c.Collect(metrics)
+}
+
+func TestPipeline_ScrapeTimeout(t *testing.T) {
+	pipeline := NewPipeline("foo")
+	collector := &contextCollectorMock{Collector: collectors.NewBuildInfoCollector()}
+	pipeline.AddCollectors(collector)
+	handler := pipeline.GetEndpointHandler()
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	require.Contains(t, responseRecorder.Body.String(), "go_build_info")
+	require.False(t, collector.hasDeadline)
+
+	request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set(scrapeTimeoutHeader, "2.5")
+	responseRecorder = httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	require.True(t, collector.hasDeadline)
+	require.WithinDuration(t, time.Now().Add(2*time.Second), collector.deadline, time.Second)
+}
+
+type describeCounterMock struct {
+	prometheus.Collector
+	describes atomic.Int32
+}
+
+func (c *describeCounterMock) Describe(descs chan<- *prometheus.Desc) {
+	c.describes.Add(1)
+	c.Collector.Describe(descs)
+}
+
+func TestPipeline_ScrapesReuseRegistry(t *testing.T) {
+	pipeline := NewPipeline("foo")
+	collector := &describeCounterMock{Collector: collectors.NewBuildInfoCollector()}
+	pipeline.AddCollectors(collector)
+	describes := collector.describes.Load()
+	handler := pipeline.GetEndpointHandler()
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			assert.Equal(t, http.StatusOK, responseRecorder.Code)
+			assert.Contains(t, responseRecorder.Body.String(), "go_build_info")
+		}()
+	}
+	wg.Wait()
+	// the collectors are not registered again by the scrapes
+	require.Equal(t, describes, collector.describes.Load())
+}
@@ -0,0 +1,333 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/metrics"
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// Triggers of the configuration reloads.
+const (
+	ReloadTriggerStartup = "startup"
+	ReloadTriggerSignal  = "signal"
+	ReloadTriggerHTTP    = "http"
+	ReloadTriggerWatch   = "watch"
+)
+
+// reloadHistorySize is how many reloads are kept in the history.
+const reloadHistorySize = 10
+
+// ReloadStatus is the outcome of a reload of the configuration.
+type ReloadStatus struct {
+	ID        uint64    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Trigger   string    `json:"trigger"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	// ConfigHashes are the hashes of the configurations served after the reload
+	ConfigHashes map[string]string `json:"configHashes"`
+}
+
+// Reloader loads the config files and applies them to the pipelines of the manager. Reloads are performed one
+// at a time in the order of their IDs, a failed reload keeps the previous pipelines serving. The reloads requested
+// while another one runs are coalesced into a single queued reload, they share its outcome. The statuses of the last
+// reloads are kept.
+type Reloader struct {
+	// mu guards the IDs, the queued reloads and the history, it is not held while the configuration is reloaded
+	mu          sync.Mutex
+	manager     *PipelineManager
+	configFiles []string
+	configDirs  []string
+	customer    string
+	// load reloads the configuration, it is replaced in tests
+	load   func() error
+	lastID uint64
+	queued *reloadBatch
+	// running is set while a goroutine performs the queued reloads
+	running     bool
+	history     []*ReloadStatus
+	failures    prometheus.Counter
+	reloads     *prometheus.CounterVec
+	lastSuccess prometheus.Gauge
+}
+
+// reloadBatch holds the reloads sharing the outcome of a single reload of the configuration,
+// done is closed once their statuses are set.
+type reloadBatch struct {
+	ids      []uint64
+	triggers []string
+	statuses []*ReloadStatus
+	done     chan struct{}
+}
+
+func NewReloader(manager *PipelineManager, configFiles, configDirs []string, customer string) *Reloader {
+	reloader := &Reloader{
+		manager:     manager,
+		configFiles: configFiles,
+		configDirs:  configDirs,
+		customer:    customer,
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "sre_exporter_config_reload_failures_total",
+			Help: "How many configuration reloads failed",
+		}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sre_exporter_config_reloads_total",
+			Help: "How many configuration reloads were performed by trigger and result",
+		}, []string{"trigger", "result"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "sre_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "When was the configuration successfully reloaded for the last time",
+		}),
+	}
+	reloader.load = reloader.reload
+	return reloader
+}
+
+// Reload loads the config files and updates the pipelines, it returns once the new pipelines are served
+// with the status of the reload.
+func (reloader *Reloader) Reload(trigger string) *ReloadStatus {
+	id, batch := reloader.enqueue(trigger)
+	<-batch.done
+	return copyReloadStatus(batch.statuses[slices.Index(batch.ids, id)])
+}
+
+// ReloadAsync queues a reload and returns its ID, the outcome is reported in the history.
+func (reloader *Reloader) ReloadAsync(trigger string) uint64 {
+	id, _ := reloader.enqueue(trigger)
+	return id
+}
+
+// enqueue adds a reload to the queued batch and starts the goroutine performing the queued reloads,
+// unless it runs already. The reloads of a batch have higher IDs than the ones of the batch being performed,
+// so that the history is ordered by ID and the last reload reported is the one whose configuration is served.
+func (reloader *Reloader) enqueue(trigger string) (uint64, *reloadBatch) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	reloader.lastID++
+	if reloader.queued == nil {
+		reloader.queued = &reloadBatch{done: make(chan struct{})}
+	}
+	batch := reloader.queued
+	batch.ids = append(batch.ids, reloader.lastID)
+	batch.triggers = append(batch.triggers, trigger)
+	if !reloader.running {
+		reloader.running = true
+		go reloader.run()
+	}
+	return reloader.lastID, batch
+}
+
+// run performs the queued reloads until none is left.
+func (reloader *Reloader) run() {
+	for {
+		reloader.mu.Lock()
+		batch := reloader.queued
+		reloader.queued = nil
+		reloader.running = batch != nil
+		reloader.mu.Unlock()
+		if batch == nil {
+			return
+		}
+		reloader.perform(batch)
+	}
+}
+
+// perform reloads the configuration once and reports its outcome for every reload of the batch.
+func (reloader *Reloader) perform(batch *reloadBatch) {
+	err := reloader.safeLoad()
+	timestamp := time.Now()
+	hashes := reloader.manager.ConfigHashes()
+	result := "success"
+	if err != nil {
+		result = "failure"
+		log.Printf("Config reload %v (%s) failed, keeping the current pipelines: %v", batch.ids, strings.Join(batch.triggers, ", "), err)
+	} else {
+		reloader.lastSuccess.Set(float64(timestamp.UnixNano()) / 1e9)
+		log.Printf("Config reload %v (%s) completed", batch.ids, strings.Join(batch.triggers, ", "))
+	}
+
+	batch.statuses = make([]*ReloadStatus, len(batch.ids))
+	for i, id := range batch.ids {
+		status := &ReloadStatus{
+			ID:           id,
+			Timestamp:    timestamp,
+			Trigger:      batch.triggers[i],
+			Success:      err == nil,
+			ConfigHashes: maps.Clone(hashes),
+		}
+		if err != nil {
+			status.Error = err.Error()
+			reloader.failures.Inc()
+		}
+		reloader.reloads.WithLabelValues(status.Trigger, result).Inc()
+		batch.statuses[i] = status
+	}
+
+	reloader.mu.Lock()
+	reloader.history = append(reloader.history, batch.statuses...)
+	if len(reloader.history) > reloadHistorySize {
+		reloader.history = slices.Delete(reloader.history, 0, len(reloader.history)-reloadHistorySize)
+	}
+	reloader.mu.Unlock()
+	close(batch.done)
+}
+
+// safeLoad reloads the configuration, a panic is reported as a failure of the reload.
+func (reloader *Reloader) safeLoad() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reload panicked: %v", r)
+		}
+	}()
+	return reloader.load()
+}
+
+func (reloader *Reloader) reload() error {
+	files, err := ResolveConfigFiles(reloader.configFiles, reloader.configDirs)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config files: %w", err)
+	}
+	configs, configHash, err := LoadConfigs(files)
+	if err != nil {
+		return err
+	}
+	return reloader.manager.UpdatePipelines(configs, configHash, reloader.customer)
+}
+
+// History returns the statuses of the last reloads, the most recent first.
+func (reloader *Reloader) History() []*ReloadStatus {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	history := make([]*ReloadStatus, len(reloader.history))
+	for i, status := range reloader.history {
+		history[len(history)-1-i] = copyReloadStatus(status)
+	}
+	return history
+}
+
+// LastStatus returns the status of the last reload, or nil before the first one.
+func (reloader *Reloader) LastStatus() *ReloadStatus {
+	if history := reloader.History(); len(history) > 0 {
+		return history[0]
+	}
+	return nil
+}
+
+// collectors returns the metrics of the reloads.
+func (reloader *Reloader) collectors() []prometheus.Collector {
+	return []prometheus.Collector{reloader.failures, reloader.reloads, reloader.lastSuccess}
+}
+
+func copyReloadStatus(status *ReloadStatus) *ReloadStatus {
+	statusCopy := *status
+	statusCopy.ConfigHashes = maps.Clone(status.ConfigHashes)
+	return &statusCopy
+}
+
+// PipelineEndpoint returns the endpoint serving the pipeline of the namespace.
+func PipelineEndpoint(namespace string) string {
+	return "/" + namespace + "/metrics"
+}
+
+// UpdatePipelines applies the configurations to the pipelines of the configured namespaces, comparing their hashes
+// with the ones of the running configurations. The pipelines of the added and changed namespaces are built off
+// to the side and swapped in at once with the removal of the pipelines of the removed namespaces, the other
+// pipelines keep serving untouched. Nothing is changed when a pipeline cannot be built.
+func (manager *PipelineManager) UpdatePipelines(configs []*models.Configuration, hashes map[string]string, customer string) error {
+	currentHashes := manager.ConfigHashes()
+
+	built := make(map[string]*Pipeline)
+	for _, config := range configs {
+		if hash, ok := currentHashes[config.Namespace]; ok && hash == hashes[config.Namespace] {
+			continue
+		}
+		collectors, err := metrics.BuildCollectorsFromConfig(config, customer)
+		if err != nil {
+			return fmt.Errorf("failed to build collectors of namespace %q: %w", config.Namespace, err)
+		}
+		pipeline, err := newPipelineWithCollectors(config.Namespace, collectors)
+		if err != nil {
+			return fmt.Errorf("failed to build pipeline %q: %w", config.Namespace, err)
+		}
+		built[PipelineEndpoint(config.Namespace)] = pipeline
+	}
+	var removed []string
+	for namespace := range currentHashes {
+		if _, ok := hashes[namespace]; !ok {
+			removed = append(removed, PipelineEndpoint(namespace))
+		}
+	}
+
+	previous := manager.swapPipelines(built, removed)
+	manager.SetConfigHashes(hashes)
+	for endpoint, pipeline := range built {
+		startCollectors(pipeline.collectors)
+		log.Printf("endpoint %q registered", endpoint)
+	}
+	for _, pipeline := range previous {
+		if err := pipeline.UnregisterCollectors(); err != nil {
+			log.Printf("Failed to unregister collectors of pipeline %q: %v", pipeline.GetNamespace(), err)
+		}
+	}
+	for _, endpoint := range removed {
+		log.Printf("endpoint %q unregistered", endpoint)
+	}
+	return nil
+}
+
+// newPipelineWithCollectors returns a pipeline with the collectors registered,
+// they are started once the pipeline is swapped in.
+func newPipelineWithCollectors(namespace string, collectors []prometheus.Collector) (*Pipeline, error) {
+	pipeline := NewPipeline(namespace)
+	for _, collector := range collectors {
+		if err := pipeline.registry.Register(pipeline.scrape.bind(collector)); err != nil {
+			return nil, fmt.Errorf("could not register collector: %w", err)
+		}
+	}
+	pipeline.collectors = collectors
+	return pipeline, nil
+}
+
+// swapPipelines registers the pipelines on their endpoints and unregisters the removed endpoints at once,
+// it returns the pipelines which are no longer served.
+func (manager *PipelineManager) swapPipelines(added map[string]*Pipeline, removed []string) []*Pipeline {
+	manager.pipelineMu.Lock()
+	defer manager.pipelineMu.Unlock()
+
+	var previous []*Pipeline
+	endpoints := maps.Clone(manager.endpoints)
+	for _, endpoint := range removed {
+		if pipeline, ok := endpoints[endpoint]; ok {
+			previous = append(previous, pipeline)
+			delete(endpoints, endpoint)
+		}
+	}
+	for _, endpoint := range slices.Sorted(maps.Keys(added)) {
+		if pipeline, ok := endpoints[endpoint]; ok {
+			previous = append(previous, pipeline)
+		}
+		endpoints[endpoint] = added[endpoint]
+	}
+
+	pipelines := slices.DeleteFunc(slices.Clone(manager.pipelines), func(p *Pipeline) bool {
+		return slices.Contains(previous, p)
+	})
+	for _, endpoint := range slices.Sorted(maps.Keys(added)) {
+		pipelines = append(pipelines, added[endpoint])
+	}
+	manager.endpoints = endpoints
+	manager.pipelines = pipelines
+	return previous
+}
@@ -0,0 +1,531 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/metrics"
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// ValidationProblem is a single problem found in a configuration. Collector and Metric are the indexes
+// of the collector and of the metric within it, they are nil when the problem is not specific to them.
+type ValidationProblem struct {
+	File      string `json:"file"`
+	Namespace string `json:"namespace,omitempty"`
+	Collector *int   `json:"collector,omitempty"`
+	Metric    *int   `json:"metric,omitempty"`
+	MetricID  string `json:"metricId,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (problem *ValidationProblem) String() string {
+	location := problem.File
+	if problem.Collector != nil {
+		location += fmt.Sprintf(": collector %d", *problem.Collector)
+	}
+	if problem.Metric != nil {
+		location += fmt.Sprintf(" metric %d", *problem.Metric)
+		if problem.MetricID != "" {
+			location += fmt.Sprintf(" (%q)", problem.MetricID)
+		}
+	}
+	return location + ": " + problem.Message
+}
+
+// ValidationError holds every problem found in the configurations.
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i := range e.Problems {
+		messages[i] = e.Problems[i].String()
+	}
+	return fmt.Sprintf("%d configuration problem(s):\n%s", len(e.Problems), strings.Join(messages, "\n"))
+}
+
+// ValidateConfigs checks the configurations loaded from the config files, in the same order, before pipelines
+// are built from them. It returns a *ValidationError reporting all the problems found, or nil.
+func ValidateConfigs(configFiles []string, configs []*models.Configuration) error {
+	var problems []ValidationProblem
+	namespaces := make(map[string]string)
+	for i, config := range configs {
+		validator := configValidator{file: configFiles[i], config: config}
+		validator.validate()
+		if previous, ok := namespaces[config.Namespace]; ok {
+			validator.report(nil, nil, "namespace %q is already used by %s", config.Namespace, previous)
+		} else {
+			namespaces[config.Namespace] = configFiles[i]
+		}
+		problems = append(problems, validator.problems...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+type configValidator struct {
+	file     string
+	config   *models.Configuration
+	problems []ValidationProblem
+}
+
+func (v *configValidator) report(collector, metric *int, format string, args ...any) {
+	problem := ValidationProblem{
+		File:      v.file,
+		Namespace: v.config.Namespace,
+		Collector: collector,
+		Metric:    metric,
+		Message:   fmt.Sprintf(format, args...),
+	}
+	if collector != nil && metric != nil {
+		problem.MetricID = v.config.Collectors[*collector].Metrics[*metric].ID
+	}
+	v.problems = append(v.problems, problem)
+}
+
+func (v *configValidator) validate() {
+	config := v.config
+	if config.Namespace == "" {
+		v.report(nil, nil, "namespace is required")
+	} else if !model.LegacyValidation.IsValidMetricName(config.Namespace) {
+		v.report(nil, nil, "invalid namespace %q", config.Namespace)
+	}
+
+	// the default source is not required when all the metrics select one of the named sources
+	usesDefault := false
+	for i := range config.Collectors {
+		for j := range config.Collectors[i].Metrics {
+			usesDefault = usesDefault || metrics.SourceName(&config.Collectors[i], &config.Collectors[i].Metrics[j]) == ""
+		}
+	}
+	if len(config.Sources) == 0 || usesDefault || config.Source.URI != "" {
+		v.validateSource("source", &config.Source)
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Sources)) {
+		if name == "" {
+			v.report(nil, nil, "source name must not be empty")
+			continue
+		}
+		source := config.Sources[name]
+		v.validateSource(fmt.Sprintf("source %q", name), &source)
+	}
+
+	collectorNames := make(map[string]int)
+	for i := range config.Collectors {
+		collector := &config.Collectors[i]
+		if previous, ok := collectorNames[collector.Name]; ok {
+			v.report(&i, nil, "collector name %q is already used by collector %d", collector.Name, previous)
+		} else {
+			collectorNames[collector.Name] = i
+		}
+		if collector.Name == "" {
+			v.report(&i, nil, "collector name is required")
+		}
+		if collector.EvaluationInterval < 0 {
+			v.report(&i, nil, "evaluationInterval must not be negative")
+		}
+		if _, ok := config.Sources[collector.Source]; collector.Source != "" && !ok {
+			v.report(&i, nil, "unknown source %q", collector.Source)
+		}
+		v.validateMetrics(i)
+	}
+	v.validateSeriesNames()
+}
+
+// validateSource checks the source, problems are reported with the source name.
+func (v *configValidator) validateSource(name string, source *models.Source) {
+	if source.URI == "" {
+		v.report(nil, nil, "%s queryURI is required", name)
+	} else if _, err := url.ParseRequestURI(source.URI); err != nil {
+		v.report(nil, nil, "invalid %s queryURI: %v", name, err)
+	}
+	if source.MaxConcurrentQueries < 0 {
+		v.report(nil, nil, "%s maxConcurrentQueries must not be negative", name)
+	}
+	v.validateTenants(name, source)
+	v.validateAuth(name, source)
+	v.validateFallback(name, source)
+	if retry := source.Retry; retry != nil {
+		if retry.MaxRetries < 0 {
+			v.report(nil, nil, "%s retry maxRetries must not be negative", name)
+		}
+		if retry.MaxBackoff > 0 && retry.MaxBackoff < retry.InitialBackoff {
+			v.report(nil, nil, "%s retry maxBackoff must not be lower than initialBackoff", name)
+		}
+	}
+	if breaker := source.CircuitBreaker; breaker != nil && breaker.FailureThreshold < 0 {
+		v.report(nil, nil, "%s circuitBreaker failureThreshold must not be negative", name)
+	}
+}
+
+func (v *configValidator) validateTenants(name string, source *models.Source) {
+	switch source.TenantMode {
+	case "", models.TenantModeFederated:
+		if source.TenantLabel != "" {
+			v.report(nil, nil, "%s tenantLabel is set but tenantMode is not %q", name, models.TenantModePerTenant)
+		}
+		return
+	case models.TenantModePerTenant:
+	default:
+		v.report(nil, nil, "unknown %s tenantMode %q", name, source.TenantMode)
+		return
+	}
+
+	if len(metrics.SplitTenants(source.Org)) == 0 {
+		v.report(nil, nil, "%s mimirOrg is required with tenantMode %q", name, models.TenantModePerTenant)
+	}
+	if source.TenantLabel != "" {
+		if err := metrics.ValidateTenantLabel(source.TenantLabel); err != nil {
+			v.report(nil, nil, "%s %v", name, err)
+		}
+	}
+}
+
+func (v *configValidator) validateAuth(name string, source *models.Source) {
+	methods := 0
+	for _, set := range []bool{source.BasicAuth != nil, source.BearerTokenFile != "", source.OAuth2 != nil} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		v.report(nil, nil, "only one of %s basicAuth, bearerTokenFile and oauth2 can be set", name)
+	}
+
+	if basicAuth := source.BasicAuth; basicAuth != nil {
+		if basicAuth.Username == "" {
+			v.report(nil, nil, "%s basicAuth username is required", name)
+		}
+		if basicAuth.Password != "" && basicAuth.PasswordFile != "" {
+			v.report(nil, nil, "only one of %s basicAuth password and passwordFile can be set", name)
+		}
+	}
+	if oauth2 := source.OAuth2; oauth2 != nil {
+		if oauth2.ClientID == "" {
+			v.report(nil, nil, "%s oauth2 clientId is required", name)
+		}
+		if oauth2.ClientSecret != "" && oauth2.ClientSecretFile != "" {
+			v.report(nil, nil, "only one of %s oauth2 clientSecret and clientSecretFile can be set", name)
+		}
+		if oauth2.TokenURL == "" {
+			v.report(nil, nil, "%s oauth2 tokenURL is required", name)
+		} else if _, err := url.ParseRequestURI(oauth2.TokenURL); err != nil {
+			v.report(nil, nil, "invalid %s oauth2 tokenURL: %v", name, err)
+		}
+	}
+	if tlsConfig := source.TLS; tlsConfig != nil && (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		v.report(nil, nil, "%s tls certFile and keyFile must be set together", name)
+	}
+}
+
+func (v *configValidator) validateFallback(name string, source *models.Source) {
+	fallback := source.Fallback
+	if fallback == nil {
+		return
+	}
+	if len(fallback.QueryURIs) == 0 {
+		v.report(nil, nil, "%s fallback queryURIs are required", name)
+	}
+	for i, uri := range fallback.QueryURIs {
+		if _, err := url.ParseRequestURI(uri); err != nil {
+			v.report(nil, nil, "invalid %s fallback queryURIs[%d]: %v", name, i, err)
+		} else if uri == source.URI || slices.Index(fallback.QueryURIs, uri) < i {
+			v.report(nil, nil, "%s fallback queryURIs[%d] %q is already used", name, i, uri)
+		}
+	}
+	switch fallback.Strategy {
+	case "", models.FallbackStrategyFailover:
+		if fallback.HedgeDelay != 0 {
+			v.report(nil, nil, "%s fallback hedgeDelay is set but strategy is not %q", name, models.FallbackStrategyHedged)
+		}
+	case models.FallbackStrategyHedged:
+		if fallback.HedgeDelay < 0 {
+			v.report(nil, nil, "%s fallback hedgeDelay must not be negative", name)
+		}
+	default:
+		v.report(nil, nil, "unknown %s fallback strategy %q", name, fallback.Strategy)
+	}
+	if fallback.FailureThreshold < 0 {
+		v.report(nil, nil, "%s fallback failureThreshold must not be negative", name)
+	}
+	if fallback.Cooldown < 0 {
+		v.report(nil, nil, "%s fallback cooldown must not be negative", name)
+	}
+}
+
+func (v *configValidator) validateMetrics(collectorIndex int) {
+	collector := &v.config.Collectors[collectorIndex]
+	metricIDs := make(map[string]int)
+	for j := range collector.Metrics {
+		metric := &collector.Metrics[j]
+		if previous, ok := metricIDs[metric.ID]; ok {
+			v.report(&collectorIndex, &j, "metric id %q is already used by metric %d", metric.ID, previous)
+		} else {
+			metricIDs[metric.ID] = j
+		}
+		v.validateMetric(collectorIndex, j)
+	}
+}
+
+func (v *configValidator) validateMetric(collectorIndex, metricIndex int) {
+	collector := &v.config.Collectors[collectorIndex]
+	metric := &collector.Metrics[metricIndex]
+	report := func(format string, args ...any) {
+		v.report(&collectorIndex, &metricIndex, format, args...)
+	}
+
+	name := prometheus.BuildFQName(v.config.Namespace, collector.Name, metric.ID)
+	if metric.ID == "" {
+		report("metric id is required")
+	} else if !model.LegacyValidation.IsValidMetricName(name) {
+		report("invalid metric name %q", name)
+	}
+
+	switch metric.Type {
+	case models.MetricTypeCounter, models.MetricTypeGauge, models.MetricTypeHistogram, models.MetricTypeNativeHistogram:
+		if metric.Query == "" {
+			report("query is required")
+		}
+	case models.MetricTypeSummary:
+		if metric.Query == "" && len(metric.QuantileQueries) == 0 {
+			report("query or quantileQueries are required")
+		}
+		for quantile := range metric.QuantileQueries {
+			if q, err := strconv.ParseFloat(quantile, 64); err != nil || q < 0 || q > 1 {
+				report("invalid quantile %q", quantile)
+			}
+		}
+	default:
+		report("unknown Type %q", metric.Type)
+	}
+
+	for _, query := range metricQueries(metric) {
+		if _, err := parser.NewParser(parser.Options{}).ParseExpr(query); err != nil {
+			report("invalid query %q: %v", query, err)
+		}
+	}
+
+	if _, ok := v.config.Sources[metric.Source]; metric.Source != "" && !ok {
+		report("unknown source %q", metric.Source)
+	}
+
+	v.validateLabels(collectorIndex, metricIndex)
+
+	if metric.Evaluation != nil {
+		if metric.Evaluation.Range <= 0 {
+			report("evaluation range must be positive")
+		}
+		if metric.Evaluation.Step < 0 || time.Duration(metric.Evaluation.Step) > time.Duration(metric.Evaluation.Range) {
+			report("evaluation step must be positive and not greater than the range")
+		}
+		switch metric.Evaluation.Aggregation {
+		case "", models.AggregationLast, models.AggregationMin, models.AggregationMax, models.AggregationAvg:
+		default:
+			report("unknown evaluation aggregation %q", metric.Evaluation.Aggregation)
+		}
+	}
+	if (metric.EvaluationDelay != nil && *metric.EvaluationDelay < 0) || metric.QueryTimeout < 0 {
+		report("evaluationDelay and queryTimeout must not be negative")
+	}
+	if err := metrics.ValidateRelabelConfigs(metric.RelabelConfigs); err != nil {
+		report("%v", err)
+	}
+}
+
+func (v *configValidator) validateLabels(collectorIndex, metricIndex int) {
+	metric := &v.config.Collectors[collectorIndex].Metrics[metricIndex]
+	report := func(format string, args ...any) {
+		v.report(&collectorIndex, &metricIndex, format, args...)
+	}
+
+	if len(metric.DestLabels) != 0 && len(metric.DestLabels) != len(metric.Labels) {
+		report("destLabels must have the same length as labels")
+	}
+	exported := metric.DestLabels
+	if len(exported) != len(metric.Labels) {
+		exported = metric.Labels
+	}
+	seen := make(map[string]bool)
+	for _, label := range exported {
+		switch {
+		case !model.LegacyValidation.IsValidLabelName(label):
+			report("invalid label name %q", label)
+		case seen[label]:
+			report("duplicate label %q", label)
+		case slices.Contains(metrics.ConstLabels[:], label):
+			report("label %q collides with a constant label", label)
+		case label == model.BucketLabel && metric.Type == models.MetricTypeHistogram,
+			label == model.QuantileLabel && metric.Type == models.MetricTypeSummary:
+			report("label %q is set by the %s type and must not be listed", label, metric.Type)
+		}
+		seen[label] = true
+	}
+	if source := v.metricSource(collectorIndex, metricIndex); source != nil && source.TenantMode == models.TenantModePerTenant {
+		tenantLabel := source.TenantLabel
+		if tenantLabel == "" {
+			tenantLabel = metrics.DefaultTenantLabel
+		}
+		seen[tenantLabel] = true
+		if slices.Contains(exported, tenantLabel) {
+			report("label %q collides with the tenant label", tenantLabel)
+		}
+	}
+
+	for label := range metric.StaticLabels {
+		switch {
+		case !model.LegacyValidation.IsValidLabelName(label):
+			report("invalid static label name %q", label)
+		case seen[label] || slices.Contains(metrics.ConstLabels[:], label):
+			report("static label %q collides with a label of the metric", label)
+		}
+	}
+}
+
+// validateSeriesNames checks that the names of the series exported for the namespace are unique. The metric names
+// are <namespace>_<collector>_<id>, so e.g. the metric "b_up" of the collector "a" collides with the health series
+// of the collector "a_b". Duplicate collector names and metric ids are reported on their own and skipped.
+func (v *configValidator) validateSeriesNames() {
+	namespace := v.config.Namespace
+	owners := make(map[string]string)
+	for _, name := range metrics.SourceHealthSeriesNames(namespace) {
+		owners[name] = "a health series of the sources"
+	}
+
+	collectors := make(map[string]bool)
+	var checked []int
+	for i := range v.config.Collectors {
+		collector := &v.config.Collectors[i]
+		if collector.Name == "" || collectors[collector.Name] {
+			continue
+		}
+		collectors[collector.Name] = true
+		checked = append(checked, i)
+		for _, name := range metrics.CollectorHealthSeriesNames(namespace, collector.Name) {
+			if owner, ok := owners[name]; ok {
+				v.report(&i, nil, "health series %q collides with %s", name, owner)
+				break
+			}
+			owners[name] = fmt.Sprintf("a health series of collector %d", i)
+		}
+	}
+
+	// the health series are registered first, so that the collisions with them are reported for the metrics
+	for _, i := range checked {
+		collector := &v.config.Collectors[i]
+		ids := make(map[string]bool)
+		for j := range collector.Metrics {
+			metric := &collector.Metrics[j]
+			if metric.ID == "" || ids[metric.ID] {
+				continue
+			}
+			ids[metric.ID] = true
+			for _, name := range metricSeriesNames(prometheus.BuildFQName(namespace, collector.Name, metric.ID), metric.Type) {
+				if owner, ok := owners[name]; ok {
+					v.report(&i, &j, "series %q collides with %s", name, owner)
+					break
+				}
+				owners[name] = fmt.Sprintf("metric %d of collector %d", j, i)
+			}
+		}
+	}
+}
+
+// metricSeriesNames returns the name of the metric family and the names of the series of its type.
+func metricSeriesNames(name, metricType string) []string {
+	switch metricType {
+	case models.MetricTypeHistogram:
+		return []string{name, name + "_bucket", name + "_sum", name + "_count"}
+	case models.MetricTypeSummary:
+		return []string{name, name + "_sum", name + "_count"}
+	default:
+		return []string{name}
+	}
+}
+
+// metricSource returns the source the metric is queried from, nil when it is unknown.
+func (v *configValidator) metricSource(collectorIndex, metricIndex int) *models.Source {
+	collector := &v.config.Collectors[collectorIndex]
+	name := metrics.SourceName(collector, &collector.Metrics[metricIndex])
+	if name == "" {
+		return &v.config.Source
+	}
+	if source, ok := v.config.Sources[name]; ok {
+		return &source
+	}
+	return nil
+}
+
+// metricQueries returns all the non empty queries of the metric.
+func metricQueries(metric *models.Metric) []string {
+	queries := []string{metric.Query, metric.SumQuery, metric.CountQuery}
+	for _, quantile := range slices.Sorted(maps.Keys(metric.QuantileQueries)) {
+		queries = append(queries, metric.QuantileQueries[quantile])
+	}
+	return slices.DeleteFunc(queries, func(query string) bool { return query == "" })
+}
+
+// CheckConfigFiles loads and validates the config files, builds their collectors and registers them as the pipelines
+// do, without querying the source. It returns a *ValidationError reporting the problems of every file, or nil.
+func CheckConfigFiles(configFiles []string, customer string) error {
+	var problems []ValidationProblem
+	files := make([]string, 0, len(configFiles))
+	configs := make([]*models.Configuration, 0, len(configFiles))
+	for i := range configFiles {
+		config, _, err := InitConfig(&configFiles[i])
+		if err != nil {
+			problems = append(problems, ValidationProblem{File: configFiles[i], Message: err.Error()})
+			continue
+		}
+		files = append(files, configFiles[i])
+		configs = append(configs, config)
+	}
+
+	var validationErr *ValidationError
+	if err := ValidateConfigs(files, configs); errors.As(err, &validationErr) {
+		problems = append(problems, validationErr.Problems...)
+	}
+	// collectors are only built from configurations without problems
+	for i, config := range configs {
+		if slices.ContainsFunc(problems, func(problem ValidationProblem) bool { return problem.File == files[i] }) {
+			continue
+		}
+		collectors, err := metrics.BuildCollectorsFromConfig(config, customer)
+		if err != nil {
+			problems = append(problems, ValidationProblem{File: files[i], Namespace: config.Namespace, Message: err.Error()})
+			continue
+		}
+		// the collectors are registered as the pipelines do, in case their descriptors conflict in a way the validation missed
+		registry := prometheus.NewRegistry()
+		for _, collector := range collectors {
+			if err := registry.Register(collector); err != nil {
+				problems = append(problems, ValidationProblem{
+					File:      files[i],
+					Namespace: config.Namespace,
+					Message:   fmt.Sprintf("could not register collector: %v", err),
+				})
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
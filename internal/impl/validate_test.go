@@ -0,0 +1,319 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package impl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+const invalidConfig = `
+{
+  "namespace": "orch",
+  "source": {"queryURI": "http://localhost:8181/prometheus", "mimirOrg": "foo"},
+  "collectors": [
+    {
+      "name": "api",
+      "enabled": true,
+      "metrics": [
+        {"id": "requests", "query": "sum(rate(requests_total[5m]))", "Type": "Counter"},
+        {"id": "requests", "query": "sum(rate(requests_total[5m])", "Type": "Counter"},
+        {"id": "latency", "query": "latency_bucket", "Type": "Histogram", "labels": ["le", "service", "bad-label"]},
+        {"id": "info", "query": "build_info", "Type": "Info"},
+        {"id": "bad-id", "query": "up", "Type": "Gauge", "staticLabels": {"customer": "foo"}},
+        {
+          "id": "quantiles",
+          "Type": "Summary",
+          "quantileQueries": {"1.5": "up"},
+          "evaluation": {"range": "1h", "aggregation": "median"},
+          "relabelConfigs": [{"regex": "(", "targetLabel": "foo"}]
+        }
+      ]
+    }
+  ]
+}
+`
+
+func loadTestConfig(t *testing.T, name, data string) *models.Configuration {
+	config, err := ParseConfig(name, []byte(data))
+	require.NoError(t, err)
+	return config
+}
+
+func TestValidateConfigs(t *testing.T) {
+	t.Run("deployed configs", func(t *testing.T) {
+		configFiles, err := filepath.Glob("../../deployments/sre-exporter/files/configs/sre-exporter-*.json")
+		require.NoError(t, err)
+		configs := make([]*models.Configuration, len(configFiles))
+		for i := range configFiles {
+			configs[i], _, err = InitConfig(&configFiles[i])
+			require.NoError(t, err)
+			// the query URI is templated by the chart
+			configs[i].Source.URI = "http://localhost:8181/prometheus"
+		}
+		require.NoError(t, ValidateConfigs(configFiles, configs))
+	})
+
+	t.Run("all problems reported", func(t *testing.T) {
+		config := loadTestConfig(t, "orch.json", invalidConfig)
+		err := ValidateConfigs([]string{"orch.json"}, []*models.Configuration{config})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			`orch.json: collector 0 metric 1 ("requests"): metric id "requests" is already used by metric 0`,
+			`orch.json: collector 0 metric 1 ("requests"): invalid query "sum(rate(requests_total[5m])": ` +
+				`1:29: parse error: unclosed left parenthesis`,
+			`orch.json: collector 0 metric 2 ("latency"): label "le" is set by the Histogram type and must not be listed`,
+			`orch.json: collector 0 metric 2 ("latency"): label "service" collides with a constant label`,
+			`orch.json: collector 0 metric 2 ("latency"): invalid label name "bad-label"`,
+			`orch.json: collector 0 metric 3 ("info"): unknown Type "Info"`,
+			`orch.json: collector 0 metric 4 ("bad-id"): invalid metric name "orch_api_bad-id"`,
+			`orch.json: collector 0 metric 4 ("bad-id"): static label "customer" collides with a label of the metric`,
+			`orch.json: collector 0 metric 5 ("quantiles"): invalid quantile "1.5"`,
+			`orch.json: collector 0 metric 5 ("quantiles"): unknown evaluation aggregation "median"`,
+			`orch.json: collector 0 metric 5 ("quantiles"): relabel config 0: invalid regex "(": ` +
+				"error parsing regexp: missing closing ): `^(?:()$`",
+		}, messages)
+		require.ErrorContains(t, err, "11 configuration problem(s):")
+	})
+
+	t.Run("duplicate namespace", func(t *testing.T) {
+		config := `{"namespace": "orch", "source": {"queryURI": "http://localhost"}, "collectors": []}`
+		configs := []*models.Configuration{
+			loadTestConfig(t, "a.json", config),
+			loadTestConfig(t, "b.yaml", config),
+			loadTestConfig(t, "c.json", `{"source": {"queryURI": "localhost"}}`),
+		}
+		err := ValidateConfigs([]string{"a.json", "b.yaml", "c.json"}, configs)
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		require.Len(t, validationErr.Problems, 3)
+		require.Equal(t, `b.yaml: namespace "orch" is already used by a.json`, validationErr.Problems[0].String())
+		require.Equal(t, "c.json: namespace is required", validationErr.Problems[1].String())
+		require.Contains(t, validationErr.Problems[2].String(), "c.json: invalid source queryURI")
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		configs := []*models.Configuration{
+			loadTestConfig(t, "a.json", `{"namespace": "a", "source": {"queryURI": "http://localhost", "tenantMode": "perTenant"},
+				"collectors": [{"name": "api", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge", "labels": ["tenant"]}]}]}`),
+			loadTestConfig(t, "b.json", `{"namespace": "b", "source": {"queryURI": "http://localhost", "mimirOrg": "foo|bar",
+				"tenantMode": "perTenant", "tenantLabel": "projectId"},
+				"collectors": [{"name": "api", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge", "staticLabels": {"projectId": "p"}}]}]}`),
+			loadTestConfig(t, "c.json", `{"namespace": "c", "source": {"queryURI": "http://localhost", "tenantMode": "other", "tenantLabel": "t"}}`),
+			loadTestConfig(t, "d.json", `{"namespace": "d", "source": {"queryURI": "http://localhost", "mimirOrg": "foo",
+				"tenantMode": "perTenant", "tenantLabel": "service"}}`),
+		}
+		err := ValidateConfigs([]string{"a.json", "b.json", "c.json", "d.json"}, configs)
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			`a.json: source mimirOrg is required with tenantMode "perTenant"`,
+			`a.json: collector 0 metric 0 ("targets"): label "tenant" collides with the tenant label`,
+			`b.json: collector 0 metric 0 ("targets"): static label "projectId" collides with a label of the metric`,
+			`c.json: unknown source tenantMode "other"`,
+			`d.json: source tenant label "service" collides with a constant label`,
+		}, messages)
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		configs := []*models.Configuration{
+			loadTestConfig(t, "a.json", `{"namespace": "a", "source": {"queryURI": "https://localhost", "bearerTokenFile": "token",
+				"basicAuth": {"username": "", "password": "p", "passwordFile": "password"}}}`),
+			loadTestConfig(t, "b.json", `{"namespace": "b", "source": {"queryURI": "https://localhost",
+				"oauth2": {"clientId": "", "clientSecret": "s", "clientSecretFile": "secret", "tokenURL": "keycloak"},
+				"tls": {"certFile": "client.crt"}}}`),
+		}
+		err := ValidateConfigs([]string{"a.json", "b.json"}, configs)
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			"a.json: only one of source basicAuth, bearerTokenFile and oauth2 can be set",
+			"a.json: source basicAuth username is required",
+			"a.json: only one of source basicAuth password and passwordFile can be set",
+			"b.json: source oauth2 clientId is required",
+			"b.json: only one of source oauth2 clientSecret and clientSecretFile can be set",
+			`b.json: invalid source oauth2 tokenURL: parse "keycloak": invalid URI for request`,
+			"b.json: source tls certFile and keyFile must be set together",
+		}, messages)
+	})
+
+	t.Run("named sources", func(t *testing.T) {
+		configs := []*models.Configuration{
+			// the default source is not used
+			loadTestConfig(t, "a.json", `{"namespace": "a", "sources": {"platform": {"queryURI": "http://localhost"}},
+				"collectors": [{"name": "api", "source": "platform", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge"}]}]}`),
+			loadTestConfig(t, "b.json", `{"namespace": "b",
+				"sources": {"": {"queryURI": "http://localhost"}, "platform": {"queryURI": "localhost", "tenantMode": "perTenant", "mimirOrg": "foo"}},
+				"collectors": [
+					{"name": "api", "source": "missing", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge"}]},
+					{"name": "edge", "metrics": [
+						{"id": "nodes", "query": "up", "Type": "Gauge", "source": "other"},
+						{"id": "targets", "query": "up", "Type": "Gauge", "source": "platform", "labels": ["tenant"]}
+					]}
+				]}`),
+		}
+		err := ValidateConfigs([]string{"a.json", "b.json"}, configs)
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			"b.json: source name must not be empty",
+			`b.json: invalid source "platform" queryURI: parse "localhost": invalid URI for request`,
+			`b.json: collector 0: unknown source "missing"`,
+			`b.json: collector 1 metric 0 ("nodes"): unknown source "other"`,
+			`b.json: collector 1 metric 1 ("targets"): label "tenant" collides with the tenant label`,
+		}, messages)
+	})
+
+	t.Run("series name collisions", func(t *testing.T) {
+		config := loadTestConfig(t, "orch.json", `{"namespace": "orch", "source": {"queryURI": "http://localhost"},
+			"collectors": [
+				{"name": "api", "metrics": [
+					{"id": "up", "query": "up", "Type": "Gauge"},
+					{"id": "cache_age_seconds", "query": "up", "Type": "Gauge"},
+					{"id": "metric_up", "query": "up", "Type": "Gauge"},
+					{"id": "metric_errors_total", "query": "up", "Type": "Counter"},
+					{"id": "tenant_count", "query": "up", "Type": "Gauge"},
+					{"id": "b_up", "query": "up", "Type": "Gauge"},
+					{"id": "latency", "query": "latency_bucket", "Type": "Histogram"},
+					{"id": "latency_count", "query": "up", "Type": "Gauge"}
+				]},
+				{"name": "api_b", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge"}]},
+				{"name": "api_metric", "metrics": [{"id": "nodes", "query": "up", "Type": "Gauge"}]},
+				{"name": "source", "metrics": [{"id": "circuit_state", "query": "up", "Type": "Gauge"}, {"id": "targets", "query": "up", "Type": "Gauge"}]}
+			]}`)
+		err := ValidateConfigs([]string{"orch.json"}, []*models.Configuration{config})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			`orch.json: collector 2: health series "orch_api_metric_up" collides with a health series of collector 0`,
+			`orch.json: collector 0 metric 0 ("up"): series "orch_api_up" collides with a health series of collector 0`,
+			`orch.json: collector 0 metric 1 ("cache_age_seconds"): series "orch_api_cache_age_seconds" collides with a health series of collector 0`,
+			`orch.json: collector 0 metric 2 ("metric_up"): series "orch_api_metric_up" collides with a health series of collector 0`,
+			`orch.json: collector 0 metric 5 ("b_up"): series "orch_api_b_up" collides with a health series of collector 1`,
+			`orch.json: collector 0 metric 7 ("latency_count"): series "orch_api_latency_count" collides with metric 6 of collector 0`,
+			`orch.json: collector 3 metric 0 ("circuit_state"): series "orch_source_circuit_state" collides with a health series of the sources`,
+		}, messages)
+	})
+
+	t.Run("fallback and retries", func(t *testing.T) {
+		config := loadTestConfig(t, "orch.json", `{"namespace": "orch",
+			"source": {"queryURI": "http://mimir-0", "fallback": {"queryURIs": ["http://mimir-1", "mimir-2", "http://mimir-0"],
+				"strategy": "random", "failureThreshold": -1}},
+			"sources": {"platform": {"queryURI": "http://localhost", "fallback": {"queryURIs": [], "hedgeDelay": "1s"},
+				"retry": {"maxRetries": -1, "initialBackoff": "2s", "maxBackoff": "1s"}, "circuitBreaker": {"failureThreshold": -1}},
+				"hedged": {"queryURI": "http://mimir-0", "fallback": {"queryURIs": ["http://mimir-1"], "strategy": "hedged", "hedgeDelay": "200ms"}}},
+			"collectors": [{"name": "api", "metrics": [{"id": "targets", "query": "up", "Type": "Gauge"}]}]}`)
+		err := ValidateConfigs([]string{"orch.json"}, []*models.Configuration{config})
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		messages := make([]string, len(validationErr.Problems))
+		for i := range validationErr.Problems {
+			messages[i] = validationErr.Problems[i].String()
+		}
+		require.Equal(t, []string{
+			`orch.json: invalid source fallback queryURIs[1]: parse "mimir-2": invalid URI for request`,
+			`orch.json: source fallback queryURIs[2] "http://mimir-0" is already used`,
+			`orch.json: unknown source fallback strategy "random"`,
+			"orch.json: source fallback failureThreshold must not be negative",
+			`orch.json: source "platform" fallback queryURIs are required`,
+			`orch.json: source "platform" fallback hedgeDelay is set but strategy is not "hedged"`,
+			`orch.json: source "platform" retry maxRetries must not be negative`,
+			`orch.json: source "platform" retry maxBackoff must not be lower than initialBackoff`,
+			`orch.json: source "platform" circuitBreaker failureThreshold must not be negative`,
+		}, messages)
+	})
+}
+
+func TestCheckConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(name, data string) string {
+		fileName := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fileName, []byte(data), 0o600))
+		return fileName
+	}
+	valid := writeConfig("valid.yaml", `
+namespace: orch
+source:
+  queryURI: http://localhost:8181/prometheus
+collectors:
+  - name: api
+    enabled: true
+    metrics:
+      - id: requests
+        query: sum(rate(requests_total[5m]))
+        Type: Counter
+`)
+	invalid := writeConfig("invalid.json", invalidConfig)
+	unknownField := writeConfig("unknown.json", `{"namespace": "foo", "unknown": true}`)
+	missing := filepath.Join(dir, "missing.json")
+
+	require.NoError(t, CheckConfigFiles([]string{valid}, "customer"))
+
+	err := CheckConfigFiles([]string{valid, invalid, unknownField, missing}, "customer")
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	files := make(map[string]int)
+	for _, problem := range validationErr.Problems {
+		files[problem.File]++
+	}
+	// invalid.json also reuses the namespace of valid.yaml
+	require.Equal(t, map[string]int{invalid: 12, unknownField: 1, missing: 1}, files)
+	require.ErrorContains(t, err, `unknown.json: unable to unmarshal: json: unknown field "unknown"`)
+
+	t.Run("destLabels length", func(t *testing.T) {
+		mismatched := writeConfig("mismatched.json", `{"namespace": "orch", "source": {"queryURI": "http://localhost"},
+			"collectors": [{"name": "api", "metrics": [
+				{"id": "requests", "query": "requests_total", "Type": "Counter", "labels": ["code", "method"], "destLabels": ["status"]},
+				{"id": "targets", "query": "up", "Type": "Gauge", "labels": ["job"]}]}]}`)
+		expected := mismatched + `: collector 0 metric 0 ("requests"): destLabels must have the same length as labels`
+		err := CheckConfigFiles([]string{mismatched}, "customer")
+		require.ErrorAs(t, err, &validationErr)
+		require.Len(t, validationErr.Problems, 1)
+		require.Equal(t, expected, validationErr.Problems[0].String())
+
+		_, _, err = LoadConfigs([]string{mismatched})
+		require.ErrorContains(t, err, expected)
+	})
+
+	t.Run("conflicting series names", func(t *testing.T) {
+		conflicting := writeConfig("conflicting.json", `{"namespace": "orch", "source": {"queryURI": "http://localhost"},
+			"collectors": [
+				{"name": "api", "enabled": true, "metrics": [{"id": "request_count", "query": "up", "Type": "Gauge", "labels": ["code"]}]},
+				{"name": "api_request", "enabled": true, "metrics": [{"id": "count", "query": "up", "Type": "Gauge"}]}
+			]}`)
+		err := CheckConfigFiles([]string{conflicting}, "customer")
+		require.ErrorAs(t, err, &validationErr)
+		require.Len(t, validationErr.Problems, 1)
+		require.Equal(t, "orch", validationErr.Problems[0].Namespace)
+		require.Equal(t, conflicting+`: collector 1 metric 0 ("count"): series "orch_api_request_count" collides with metric 0 of collector 0`,
+			validationErr.Problems[0].String())
+	})
+}
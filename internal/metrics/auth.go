@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// oauth2TokenTimeout limits the duration of the access token requests.
+const oauth2TokenTimeout = 10 * time.Second
+
+// newSourceRoundTripper returns the round tripper sending the queries to the source
+// with its TLS configuration and authentication.
+func newSourceRoundTripper(source *models.Source) (http.RoundTripper, error) {
+	defaultTransport, ok := api.DefaultRoundTripper.(*http.Transport)
+	if !ok {
+		return nil, errors.New("unexpected type of the default round tripper")
+	}
+	transport := defaultTransport.Clone()
+	if source.TLS != nil {
+		tlsConfig, err := newTLSConfig(source.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	switch {
+	case source.BasicAuth != nil:
+		rt := &basicAuthRoundTripper{rt: transport, username: source.BasicAuth.Username, password: source.BasicAuth.Password}
+		if source.BasicAuth.PasswordFile != "" {
+			rt.passwordFile = &fileSecret{path: source.BasicAuth.PasswordFile}
+		}
+		return rt, nil
+	case source.BearerTokenFile != "":
+		return &bearerTokenRoundTripper{rt: transport, token: &fileSecret{path: source.BearerTokenFile}}, nil
+	case source.OAuth2 != nil:
+		tokenSource := &oauth2TokenSource{
+			config: source.OAuth2,
+			client: &http.Client{Transport: transport, Timeout: oauth2TokenTimeout},
+		}
+		if source.OAuth2.ClientSecretFile != "" {
+			tokenSource.clientSecretFile = &fileSecret{path: source.OAuth2.ClientSecretFile}
+		}
+		return &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, tokenSource), Base: transport}, nil
+	default:
+		return transport, nil
+	}
+}
+
+// newTLSConfig loads the CA bundle of the TLS configuration. The client certificate is loaded on every handshake,
+// it is loaded once here so that a wrong configuration is reported when the collectors are built.
+func newTLSConfig(config *models.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.CAFile != "" {
+		ca, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in CA file %q", config.CAFile)
+		}
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// fileSecret is a secret read from a file. The file is read again when its modification time or size changes,
+// e.g. when a mounted Secret is updated, so that the secret can be rotated without a reload.
+type fileSecret struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func (secret *fileSecret) get() (string, error) {
+	info, err := os.Stat(secret.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret.mu.Lock()
+	defer secret.mu.Unlock()
+	if secret.value != "" && info.ModTime().Equal(secret.modTime) && info.Size() == secret.size {
+		return secret.value, nil
+	}
+	data, err := os.ReadFile(secret.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret.value = strings.TrimSpace(string(data))
+	secret.modTime = info.ModTime()
+	secret.size = info.Size()
+	return secret.value, nil
+}
+
+type basicAuthRoundTripper struct {
+	rt       http.RoundTripper
+	username string
+	password string
+	// passwordFile takes precedence over password when it is set
+	passwordFile *fileSecret
+}
+
+// RoundTrip adds the basic authentication credentials to the request.
+func (b *basicAuthRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	password := b.password
+	if b.passwordFile != nil {
+		var err error
+		if password, err = b.passwordFile.get(); err != nil {
+			return nil, err
+		}
+	}
+	r = r.Clone(r.Context())
+	r.SetBasicAuth(b.username, password)
+	return b.rt.RoundTrip(r)
+}
+
+type bearerTokenRoundTripper struct {
+	rt    http.RoundTripper
+	token *fileSecret
+}
+
+// RoundTrip adds the bearer token to the request.
+func (b *bearerTokenRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := b.token.get()
+	if err != nil {
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return b.rt.RoundTrip(r)
+}
+
+// oauth2TokenSource requests access tokens with the client credentials grant. The client secret file is read
+// before every token request, the tokens are reused until they expire by oauth2.ReuseTokenSource.
+type oauth2TokenSource struct {
+	config           *models.OAuth2
+	clientSecretFile *fileSecret
+	client           *http.Client
+}
+
+func (source *oauth2TokenSource) Token() (*oauth2.Token, error) {
+	clientSecret := source.config.ClientSecret
+	if source.clientSecretFile != nil {
+		var err error
+		if clientSecret, err = source.clientSecretFile.get(); err != nil {
+			return nil, err
+		}
+	}
+	params := make(url.Values, len(source.config.EndpointParams))
+	for name, value := range source.config.EndpointParams {
+		params.Set(name, value)
+	}
+	config := clientcredentials.Config{
+		ClientID:       source.config.ClientID,
+		ClientSecret:   clientSecret,
+		TokenURL:       source.config.TokenURL,
+		Scopes:         source.config.Scopes,
+		EndpointParams: params,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, source.client)
+	token, err := config.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth2 token: %w", err)
+	}
+	return token, nil
+}
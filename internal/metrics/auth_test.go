@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+func writeSecretFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// sendSourceRequest sends a request to the URL with the round tripper of the source and returns the status code.
+func sendSourceRequest(t *testing.T, source *models.Source, url string) int {
+	rt, err := newSourceRoundTripper(source)
+	require.NoError(t, err)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode
+}
+
+func TestSourceBasicAuth(t *testing.T) {
+	var username, password string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		var ok bool
+		username, password, ok = req.BasicAuth()
+		assert.True(t, ok)
+	}))
+	defer server.Close()
+
+	source := &models.Source{BasicAuth: &models.BasicAuth{Username: "sre", Password: "secret"}}
+	require.Equal(t, http.StatusOK, sendSourceRequest(t, source, server.URL))
+	require.Equal(t, "sre", username)
+	require.Equal(t, "secret", password)
+
+	// the password file is read again when it changes
+	passwordFile := writeSecretFile(t, t.TempDir(), "password", "first\n")
+	source = &models.Source{BasicAuth: &models.BasicAuth{Username: "sre", PasswordFile: passwordFile}}
+	rt, err := newSourceRoundTripper(source)
+	require.NoError(t, err)
+	send := func() {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	send()
+	require.Equal(t, "first", password)
+	writeSecretFile(t, filepath.Dir(passwordFile), "password", "rotated\n")
+	send()
+	require.Equal(t, "rotated", password)
+}
+
+func TestSourceBearerTokenFile(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	source := &models.Source{BearerTokenFile: writeSecretFile(t, dir, "token", "token-1\n")}
+	rt, err := newSourceRoundTripper(source)
+	require.NoError(t, err)
+	send := func() error {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	require.NoError(t, send())
+	require.Equal(t, "Bearer token-1", authorization)
+	writeSecretFile(t, dir, "token", "rotated-token-2\n")
+	require.NoError(t, send())
+	require.Equal(t, "Bearer rotated-token-2", authorization)
+
+	require.NoError(t, os.Remove(source.BearerTokenFile))
+	require.ErrorContains(t, send(), "failed to read secret")
+}
+
+func TestSourceOAuth2(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "client_credentials", req.Form.Get("grant_type"))
+		assert.Equal(t, "metrics", req.Form.Get("scope"))
+		assert.Equal(t, "mimir", req.Form.Get("audience"))
+		clientID, clientSecret, _ := req.BasicAuth()
+		assert.Equal(t, "sre-exporter", clientID)
+		assert.Equal(t, "rotated-secret", clientSecret)
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := rw.Write([]byte(`{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600}`))
+		assert.NoError(t, err)
+	}))
+	defer tokenServer.Close()
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	source := &models.Source{OAuth2: &models.OAuth2{
+		ClientID:         "sre-exporter",
+		ClientSecretFile: writeSecretFile(t, t.TempDir(), "client-secret", "rotated-secret"),
+		TokenURL:         tokenServer.URL,
+		Scopes:           []string{"metrics"},
+		EndpointParams:   map[string]string{"audience": "mimir"},
+	}}
+	rt, err := newSourceRoundTripper(source)
+	require.NoError(t, err)
+	for range 2 {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	require.Equal(t, "Bearer access-token", authorization)
+	// the token is reused until it expires
+	require.Equal(t, 1, tokenRequests)
+}
+
+func TestSourceTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey := newClientCertificate(t)
+	certFile := writeSecretFile(t, dir, "client.crt", string(clientCert))
+	keyFile := writeSecretFile(t, dir, "client.key", string(clientKey))
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(clientCert))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		assert.Len(t, req.TLS.PeerCertificates, 1)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writeSecretFile(t, dir, "ca.crt",
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	source := &models.Source{TLS: &models.TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}}
+	require.Equal(t, http.StatusOK, sendSourceRequest(t, source, server.URL))
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		_, err := newSourceRoundTripper(&models.Source{TLS: &models.TLSConfig{CAFile: keyFile}})
+		require.ErrorContains(t, err, "no certificate found in CA file")
+		_, err = newSourceRoundTripper(&models.Source{TLS: &models.TLSConfig{CertFile: certFile, KeyFile: caFile}})
+		require.ErrorContains(t, err, "failed to load client certificate")
+		_, err = newSourceRoundTripper(&models.Source{TLS: &models.TLSConfig{CAFile: filepath.Join(dir, "missing.crt")}})
+		require.ErrorContains(t, err, "failed to read CA file")
+	})
+}
+
+// newClientCertificate returns a self-signed client certificate and its key, PEM encoded.
+func newClientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sre-exporter"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+const (
+	// DefaultMaxConcurrentQueries is used when Source.MaxConcurrentQueries is not set.
+	DefaultMaxConcurrentQueries = 4
+	// DefaultQueryTimeout is used when neither Source.QueryTimeout nor Metric.QueryTimeout is set.
+	DefaultQueryTimeout = 5 * time.Second
+	// DefaultTenantLabel is used when Source.TenantLabel is not set.
+	DefaultTenantLabel = "tenant"
+)
+
+// queryBackend is the query API of a source shared by all collectors built from a configuration.
+// The limiter bounds the number of queries in flight to the source across all the collectors.
+type queryBackend struct {
+	// name is the name of the source, empty for the default source
+	name    string
+	v1api   promv1.API
+	source  *models.Source
+	limiter chan struct{}
+	// tenants are queried one by one and their results labeled with tenantLabel, they are empty
+	// when all the tenants are queried at once
+	tenants     []string
+	tenantLabel string
+	// fallback is set when the source has fallback endpoints
+	fallback *fallbackRoundTripper
+	// retry and breaker are set when the source configures them
+	retry   *retryPolicy
+	breaker *circuitBreaker
+	retries atomic.Uint64
+}
+
+// newQueryBackend returns the backend of the source with the given name, the default source is named "".
+func newQueryBackend(name string, source *models.Source) (*queryBackend, error) {
+	rt, err := newSourceRoundTripper(source)
+	if err != nil {
+		return nil, err
+	}
+	var fallback *fallbackRoundTripper
+	if source.Fallback != nil {
+		if fallback, err = newFallbackRoundTripper(rt, name, source); err != nil {
+			return nil, err
+		}
+		rt = fallback
+	}
+	client, err := api.NewClient(api.Config{
+		Address:      source.URI,
+		RoundTripper: newMimirRoundTripper(rt, &source.Org),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+	backend := newQueryBackendForAPI(promv1.NewAPI(client), source)
+	backend.name = name
+	backend.fallback = fallback
+	return backend, nil
+}
+
+func newQueryBackendForAPI(v1api promv1.API, source *models.Source) *queryBackend {
+	maxConcurrentQueries := source.MaxConcurrentQueries
+	if maxConcurrentQueries <= 0 {
+		maxConcurrentQueries = DefaultMaxConcurrentQueries
+	}
+	backend := &queryBackend{
+		v1api:   v1api,
+		source:  source,
+		limiter: make(chan struct{}, maxConcurrentQueries),
+	}
+	if source.Retry != nil {
+		backend.retry = newRetryPolicy(source.Retry)
+	}
+	if source.CircuitBreaker != nil {
+		backend.breaker = newCircuitBreaker(source.CircuitBreaker)
+	}
+	if source.TenantMode == models.TenantModePerTenant {
+		backend.tenants = SplitTenants(source.Org)
+		backend.tenantLabel = source.TenantLabel
+		if backend.tenantLabel == "" {
+			backend.tenantLabel = DefaultTenantLabel
+		}
+	}
+	return backend
+}
+
+// SplitTenants returns the tenants of an org joined with "|", without the empty ones.
+func SplitTenants(org string) []string {
+	var tenants []string
+	for _, tenant := range strings.Split(org, "|") {
+		if tenant = strings.TrimSpace(tenant); tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
+
+// acquire blocks until another query can be sent to the source or the context is done.
+func (backend *queryBackend) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("waiting for query slot: %w", err)
+	}
+	select {
+	case backend.limiter <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for query slot: %w", ctx.Err())
+	}
+}
+
+// queryTimeout returns the timeout of the metric queries, the metric timeout takes precedence over the source one.
+func (backend *queryBackend) queryTimeout(metric *models.Metric) time.Duration {
+	switch {
+	case metric.QueryTimeout > 0:
+		return time.Duration(metric.QueryTimeout)
+	case backend.source.QueryTimeout > 0:
+		return time.Duration(backend.source.QueryTimeout)
+	default:
+		return DefaultQueryTimeout
+	}
+}
+
+func (backend *queryBackend) release() {
+	<-backend.limiter
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"fmt"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// evaluationRange returns the range query parameters of the evaluation ending at the given time.
+func evaluationRange(evaluation *models.Evaluation, end time.Time) (promv1.Range, error) {
+	if evaluation.Range <= 0 {
+		return promv1.Range{}, fmt.Errorf("evaluation range %q must be positive", evaluation.Range)
+	}
+	step := evaluation.Step
+	if step == 0 {
+		step = models.DefaultEvaluationStep
+	}
+	if step < 0 {
+		return promv1.Range{}, fmt.Errorf("evaluation step %q must be positive", step)
+	}
+
+	return promv1.Range{
+		Start: end.Add(-time.Duration(evaluation.Range)),
+		End:   end,
+		Step:  time.Duration(step),
+	}, nil
+}
+
+// reduceMatrix reduces every series of the matrix to a single sample with the given aggregation.
+// The timestamp of the reduced sample is the timestamp of the last point of the series.
+// Series without points are dropped. Native histograms support only the last aggregation.
+func reduceMatrix(matrix model.Matrix, aggregation string) (model.Vector, error) {
+	if aggregation == "" {
+		aggregation = models.AggregationLast
+	}
+
+	vector := make(model.Vector, 0, len(matrix))
+	for _, stream := range matrix {
+		if len(stream.Histograms) > 0 {
+			if aggregation != models.AggregationLast {
+				return nil, fmt.Errorf("aggregation %q is not supported for native histograms", aggregation)
+			}
+			last := stream.Histograms[len(stream.Histograms)-1]
+			vector = append(vector, &model.Sample{Metric: stream.Metric, Histogram: last.Histogram, Timestamp: last.Timestamp})
+			continue
+		}
+		if len(stream.Values) == 0 {
+			continue
+		}
+
+		value, err := aggregateValues(stream.Values, aggregation)
+		if err != nil {
+			return nil, err
+		}
+		vector = append(vector, &model.Sample{
+			Metric:    stream.Metric,
+			Value:     value,
+			Timestamp: stream.Values[len(stream.Values)-1].Timestamp,
+		})
+	}
+	return vector, nil
+}
+
+func aggregateValues(values []model.SamplePair, aggregation string) (model.SampleValue, error) {
+	result := values[len(values)-1].Value
+	switch aggregation {
+	case models.AggregationLast:
+	case models.AggregationMin:
+		for _, pair := range values {
+			result = min(result, pair.Value)
+		}
+	case models.AggregationMax:
+		for _, pair := range values {
+			result = max(result, pair.Value)
+		}
+	case models.AggregationAvg:
+		var sum model.SampleValue
+		for _, pair := range values {
+			sum += pair.Value
+		}
+		result = sum / model.SampleValue(len(values))
+	default:
+		return 0, fmt.Errorf("unknown aggregation %q", aggregation)
+	}
+	return result, nil
+}
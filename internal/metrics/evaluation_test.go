@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+func TestEvaluationRange(t *testing.T) {
+	end := time.Unix(1709021460, 0)
+
+	t.Run("default step", func(t *testing.T) {
+		queryRange, err := evaluationRange(&models.Evaluation{Range: model.Duration(24 * time.Hour)}, end)
+		require.NoError(t, err)
+		require.Equal(t, end.Add(-24*time.Hour), queryRange.Start)
+		require.Equal(t, end, queryRange.End)
+		require.Equal(t, time.Minute, queryRange.Step)
+	})
+
+	t.Run("custom step", func(t *testing.T) {
+		evaluation := models.Evaluation{Range: model.Duration(time.Hour), Step: model.Duration(5 * time.Minute)}
+		queryRange, err := evaluationRange(&evaluation, end)
+		require.NoError(t, err)
+		require.Equal(t, end.Add(-time.Hour), queryRange.Start)
+		require.Equal(t, 5*time.Minute, queryRange.Step)
+	})
+
+	t.Run("missing range", func(t *testing.T) {
+		_, err := evaluationRange(&models.Evaluation{}, end)
+		require.Error(t, err)
+	})
+
+	t.Run("range from config", func(t *testing.T) {
+		var evaluation models.Evaluation
+		require.NoError(t, json.Unmarshal([]byte(`{"range": "1d", "step": "5m", "aggregation": "max"}`), &evaluation))
+		queryRange, err := evaluationRange(&evaluation, end)
+		require.NoError(t, err)
+		require.Equal(t, end.Add(-24*time.Hour), queryRange.Start)
+		require.Equal(t, 5*time.Minute, queryRange.Step)
+	})
+}
+
+func TestReduceMatrix(t *testing.T) {
+	matrix := model.Matrix{
+		{
+			Metric: model.Metric{"instance": "a"},
+			Values: []model.SamplePair{{Timestamp: 1000, Value: 3}, {Timestamp: 2000, Value: 1}, {Timestamp: 3000, Value: 2}},
+		},
+		{
+			Metric: model.Metric{"instance": "b"},
+		},
+	}
+
+	tests := []struct {
+		aggregation string
+		expected    model.SampleValue
+	}{
+		{aggregation: "", expected: 2},
+		{aggregation: models.AggregationLast, expected: 2},
+		{aggregation: models.AggregationMin, expected: 1},
+		{aggregation: models.AggregationMax, expected: 3},
+		{aggregation: models.AggregationAvg, expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.aggregation, func(t *testing.T) {
+			vector, err := reduceMatrix(matrix, tt.aggregation)
+			require.NoError(t, err)
+			// series without points is dropped
+			require.Len(t, vector, 1)
+			require.Equal(t, model.Metric{"instance": "a"}, vector[0].Metric)
+			require.Equal(t, model.Time(3000), vector[0].Timestamp)
+			require.InDelta(t, float64(tt.expected), float64(vector[0].Value), 1e-9)
+		})
+	}
+
+	t.Run("unknown aggregation", func(t *testing.T) {
+		_, err := reduceMatrix(matrix, "median")
+		require.Error(t, err)
+	})
+
+	t.Run("native histograms", func(t *testing.T) {
+		histograms := model.Matrix{
+			{
+				Metric: model.Metric{"instance": "a"},
+				Histograms: []model.SampleHistogramPair{
+					{Timestamp: 1000, Histogram: &model.SampleHistogram{Count: 1}},
+					{Timestamp: 2000, Histogram: &model.SampleHistogram{Count: 2}},
+				},
+			},
+		}
+		vector, err := reduceMatrix(histograms, models.AggregationLast)
+		require.NoError(t, err)
+		require.Len(t, vector, 1)
+		require.InDelta(t, 2, float64(vector[0].Histogram.Count), 0)
+
+		_, err = reduceMatrix(histograms, models.AggregationMax)
+		require.Error(t, err)
+	})
+}
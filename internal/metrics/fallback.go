@@ -0,0 +1,336 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+const (
+	// DefaultHedgeDelay is used when Fallback.HedgeDelay is not set.
+	DefaultHedgeDelay = time.Second
+	// DefaultEndpointFailureThreshold is used when Fallback.FailureThreshold is not set.
+	DefaultEndpointFailureThreshold = 3
+	// DefaultEndpointCooldown is used when Fallback.Cooldown is not set.
+	DefaultEndpointCooldown = 30 * time.Second
+
+	// defaultSourceName is the value of the source label of the default source.
+	defaultSourceName = "default"
+
+	labelSource   = "source"
+	labelEndpoint = "endpoint"
+)
+
+// sourceEndpoint is an endpoint of a source with its health. The circuit of the endpoint is opened for the cooldown
+// after failureThreshold consecutive failures, the endpoint is then skipped unless all the endpoints are skipped.
+type sourceEndpoint struct {
+	url *url.URL
+	// name is the URL without the credentials, used as the endpoint label
+	name string
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+
+	attempts atomic.Uint64
+	failures atomic.Uint64
+	selected atomic.Uint64
+}
+
+func (endpoint *sourceEndpoint) available(now time.Time) bool {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	return !now.Before(endpoint.openUntil)
+}
+
+func (endpoint *sourceEndpoint) recordFailure(threshold int, cooldown time.Duration) {
+	endpoint.failures.Add(1)
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	endpoint.consecutiveFailures++
+	if endpoint.consecutiveFailures >= threshold {
+		endpoint.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+func (endpoint *sourceEndpoint) recordSuccess() {
+	endpoint.selected.Add(1)
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+	endpoint.consecutiveFailures = 0
+	endpoint.openUntil = time.Time{}
+}
+
+// fallbackRoundTripper sends the requests to the first available endpoint of the source and to the next ones
+// when it fails or, with the hedged strategy, when it does not answer within the hedge delay.
+// The requests are built by the API client for the first endpoint, their URL is rewritten for the others.
+type fallbackRoundTripper struct {
+	rt        http.RoundTripper
+	source    string
+	endpoints []*sourceEndpoint
+	// hedgeDelay is zero with the failover strategy
+	hedgeDelay       time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+func newFallbackRoundTripper(rt http.RoundTripper, name string, source *models.Source) (*fallbackRoundTripper, error) {
+	fallback := source.Fallback
+	f := &fallbackRoundTripper{
+		rt:               rt,
+		source:           name,
+		failureThreshold: fallback.FailureThreshold,
+		cooldown:         time.Duration(fallback.Cooldown),
+	}
+	if f.source == "" {
+		f.source = defaultSourceName
+	}
+	if fallback.Strategy == models.FallbackStrategyHedged {
+		f.hedgeDelay = time.Duration(fallback.HedgeDelay)
+		if f.hedgeDelay <= 0 {
+			f.hedgeDelay = DefaultHedgeDelay
+		}
+	}
+	if f.failureThreshold <= 0 {
+		f.failureThreshold = DefaultEndpointFailureThreshold
+	}
+	if f.cooldown <= 0 {
+		f.cooldown = DefaultEndpointCooldown
+	}
+	for _, uri := range append([]string{source.URI}, fallback.QueryURIs...) {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %w", uri, err)
+		}
+		u.Path = strings.TrimRight(u.Path, "/")
+		f.endpoints = append(f.endpoints, &sourceEndpoint{url: u, name: u.Redacted()})
+	}
+	return f, nil
+}
+
+// selectEndpoints returns the endpoints to try in order, the ones with an open circuit are skipped
+// unless all of them are open.
+func (f *fallbackRoundTripper) selectEndpoints() []*sourceEndpoint {
+	now := time.Now()
+	var endpoints []*sourceEndpoint
+	for _, endpoint := range f.endpoints {
+		if endpoint.available(now) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return f.endpoints
+	}
+	return endpoints
+}
+
+// endpointAttempt is the outcome of sending a request to the endpoint with the given index.
+type endpointAttempt struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+func (attempt *endpointAttempt) failed() bool {
+	return attempt.err != nil || attempt.resp.StatusCode >= http.StatusInternalServerError
+}
+
+// RoundTrip returns the first successful response of the endpoints, or the last failure when all of them failed.
+func (f *fallbackRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	endpoints := f.selectEndpoints()
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		// the body cannot be sent again
+		endpoints = endpoints[:1]
+	}
+	results := make(chan endpointAttempt, len(endpoints))
+	cancels := make([]context.CancelFunc, len(endpoints))
+	launched, pending := 0, 0
+	launch := func() {
+		index := launched
+		launched++
+		pending++
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels[index] = cancel
+		endpoints[index].attempts.Add(1)
+		go func() {
+			resp, err := f.send(ctx, r, endpoints[index])
+			results <- endpointAttempt{index: index, resp: resp, err: err}
+		}()
+	}
+
+	var hedge *time.Timer
+	if f.hedgeDelay > 0 {
+		hedge = time.NewTimer(f.hedgeDelay)
+		defer hedge.Stop()
+	}
+	launch()
+	var last *endpointAttempt
+	for pending > 0 {
+		var hedgeC <-chan time.Time
+		if hedge != nil && launched < len(endpoints) {
+			hedgeC = hedge.C
+		}
+		select {
+		case <-hedgeC:
+			launch()
+			hedge.Reset(f.hedgeDelay)
+		case attempt := <-results:
+			pending--
+			if !attempt.failed() {
+				endpoints[attempt.index].recordSuccess()
+				for i, cancel := range cancels {
+					if i != attempt.index && cancel != nil {
+						cancel()
+					}
+				}
+				discardAttempt(last)
+				go drainAttempts(results, pending)
+				attempt.resp.Body = &cancelBody{ReadCloser: attempt.resp.Body, cancel: cancels[attempt.index]}
+				return attempt.resp, nil
+			}
+			// requests canceled by the caller are not failures of the endpoint
+			if r.Context().Err() == nil {
+				endpoints[attempt.index].recordFailure(f.failureThreshold, f.cooldown)
+			}
+			if last != nil {
+				discardAttempt(last)
+				cancels[last.index]()
+			}
+			last = &attempt
+			if launched < len(endpoints) {
+				launch()
+				if hedge != nil {
+					hedge.Reset(f.hedgeDelay)
+				}
+			}
+		}
+	}
+
+	if last.err != nil {
+		cancels[last.index]()
+		return nil, last.err
+	}
+	last.resp.Body = &cancelBody{ReadCloser: last.resp.Body, cancel: cancels[last.index]}
+	return last.resp, nil
+}
+
+// send sends the request to the endpoint, the body is read again from the request when it is set.
+func (f *fallbackRoundTripper) send(ctx context.Context, r *http.Request, endpoint *sourceEndpoint) (*http.Response, error) {
+	req := r.Clone(ctx)
+	if r.GetBody != nil && r.Body != nil && r.Body != http.NoBody {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = body
+	}
+	u := *endpoint.url
+	u.Path = endpoint.url.Path + strings.TrimPrefix(r.URL.Path, f.endpoints[0].url.Path)
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	req.URL = &u
+	req.Host = ""
+	resp, err := f.rt.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %s: %w", endpoint.name, err)
+	}
+	return resp, nil
+}
+
+// discardAttempt closes the response of a failed attempt which is not returned.
+func discardAttempt(attempt *endpointAttempt) {
+	if attempt != nil && attempt.resp != nil {
+		attempt.resp.Body.Close()
+	}
+}
+
+// drainAttempts discards the responses of the attempts still in flight once a response was returned.
+func drainAttempts(results <-chan endpointAttempt, pending int) {
+	for range pending {
+		attempt := <-results
+		discardAttempt(&attempt)
+	}
+}
+
+// cancelBody cancels the context of the request once its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// fallbackHealth exports the health and the selection of the endpoints of the sources with fallback endpoints.
+type fallbackHealth struct {
+	sources  []*fallbackRoundTripper
+	up       *prometheus.Desc
+	attempts *prometheus.Desc
+	failures *prometheus.Desc
+	selected *prometheus.Desc
+}
+
+func newFallbackHealth(namespace string, constLabels prometheus.Labels, sources []*fallbackRoundTripper) *fallbackHealth {
+	labels := []string{labelSource, labelEndpoint}
+	return &fallbackHealth{
+		sources: sources,
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "endpoint_up"),
+			"Is the circuit of the endpoint closed, endpoints with an open circuit are skipped until their cooldown ends",
+			labels, constLabels),
+		attempts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "endpoint_attempts_total"),
+			"How many requests were sent to the endpoint",
+			labels, constLabels),
+		failures: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "endpoint_failures_total"),
+			"How many requests to the endpoint failed with an error or a 5xx status code",
+			labels, constLabels),
+		selected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "endpoint_selected_total"),
+			"How many responses of the endpoint were used",
+			labels, constLabels),
+	}
+}
+
+func (health *fallbackHealth) Describe(descs chan<- *prometheus.Desc) {
+	descs <- health.up
+	descs <- health.attempts
+	descs <- health.failures
+	descs <- health.selected
+}
+
+func (health *fallbackHealth) Collect(metrics chan<- prometheus.Metric) {
+	now := time.Now()
+	for _, source := range health.sources {
+		for _, endpoint := range source.endpoints {
+			var upf float64
+			if endpoint.available(now) {
+				upf = 1
+			}
+			metrics <- prometheus.MustNewConstMetric(health.up, prometheus.GaugeValue, upf, source.source, endpoint.name)
+			metrics <- prometheus.MustNewConstMetric(
+				health.attempts, prometheus.CounterValue, float64(endpoint.attempts.Load()), source.source, endpoint.name)
+			metrics <- prometheus.MustNewConstMetric(
+				health.failures, prometheus.CounterValue, float64(endpoint.failures.Load()), source.source, endpoint.name)
+			metrics <- prometheus.MustNewConstMetric(
+				health.selected, prometheus.CounterValue, float64(endpoint.selected.Load()), source.source, endpoint.name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+const fallbackQueryResponse = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1,"1"]}]}}`
+
+// newEndpointServer returns a query API serving under the /prometheus prefix, answering with the status code
+// after the delay. The queries it received are counted.
+func newEndpointServer(t *testing.T, status *atomic.Int64, delay time.Duration, queries *atomic.Int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		queries.Add(1)
+		assert.Equal(t, "/prometheus/api/v1/query", req.URL.Path)
+		assert.NoError(t, req.ParseForm())
+		assert.Equal(t, "up", req.Form.Get("query"))
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+		code := int(status.Load())
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(code)
+		if code == http.StatusOK {
+			_, err := rw.Write([]byte(fallbackQueryResponse))
+			assert.NoError(t, err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func queryFallbackBackend(t *testing.T, backend *queryBackend) error {
+	_, _, err := backend.v1api.Query(t.Context(), "up", time.Now())
+	return err
+}
+
+func TestFallbackFailover(t *testing.T) {
+	var primaryStatus, fallbackStatus atomic.Int64
+	var primaryQueries, fallbackQueries atomic.Int64
+	primaryStatus.Store(http.StatusServiceUnavailable)
+	fallbackStatus.Store(http.StatusOK)
+	primary := newEndpointServer(t, &primaryStatus, 0, &primaryQueries)
+	fallback := newEndpointServer(t, &fallbackStatus, 0, &fallbackQueries)
+
+	source := &models.Source{
+		URI: primary.URL + "/prometheus/",
+		Fallback: &models.Fallback{
+			QueryURIs:        []string{fallback.URL + "/prometheus"},
+			FailureThreshold: 2,
+			Cooldown:         model.Duration(time.Hour),
+		},
+	}
+	backend, err := newQueryBackend("mimir", source)
+	require.NoError(t, err)
+
+	for range 3 {
+		require.NoError(t, queryFallbackBackend(t, backend))
+	}
+	// the circuit of the primary endpoint is open after 2 failures
+	require.Equal(t, int64(2), primaryQueries.Load())
+	require.Equal(t, int64(3), fallbackQueries.Load())
+
+	health := newFallbackHealth("orch", prometheus.Labels{"service": "orch"}, []*fallbackRoundTripper{backend.fallback})
+	expected := strings.NewReader(strings.ReplaceAll(strings.ReplaceAll(`
+		# HELP orch_source_endpoint_up Is the circuit of the endpoint closed, endpoints with an open circuit are skipped until their cooldown ends
+		# TYPE orch_source_endpoint_up gauge
+		orch_source_endpoint_up{endpoint="PRIMARY/prometheus",service="orch",source="mimir"} 0
+		orch_source_endpoint_up{endpoint="FALLBACK/prometheus",service="orch",source="mimir"} 1
+		# HELP orch_source_endpoint_selected_total How many responses of the endpoint were used
+		# TYPE orch_source_endpoint_selected_total counter
+		orch_source_endpoint_selected_total{endpoint="PRIMARY/prometheus",service="orch",source="mimir"} 0
+		orch_source_endpoint_selected_total{endpoint="FALLBACK/prometheus",service="orch",source="mimir"} 3
+	`, "PRIMARY", primary.URL), "FALLBACK", fallback.URL))
+	require.NoError(t, testutil.CollectAndCompare(health, expected,
+		"orch_source_endpoint_up", "orch_source_endpoint_selected_total"))
+
+	t.Run("last failure is returned", func(t *testing.T) {
+		fallbackStatus.Store(http.StatusBadGateway)
+		query := func() {
+			ctx, status := withResponseStatus(t.Context())
+			_, _, err := backend.v1api.Query(ctx, "up", time.Now())
+			require.Error(t, err)
+			require.Equal(t, errorReasonHTTPPrefix+"502", queryErrorReason(err, *status))
+		}
+		// the fallback endpoint fails twice, then both circuits are open and both endpoints are tried again
+		query()
+		query()
+		require.Equal(t, int64(2), primaryQueries.Load())
+		query()
+		require.Equal(t, int64(3), primaryQueries.Load())
+		require.Equal(t, int64(6), fallbackQueries.Load())
+	})
+}
+
+func TestFallbackHedged(t *testing.T) {
+	var status atomic.Int64
+	var primaryQueries, fallbackQueries atomic.Int64
+	status.Store(http.StatusOK)
+	primary := newEndpointServer(t, &status, 10*time.Second, &primaryQueries)
+	fallback := newEndpointServer(t, &status, 0, &fallbackQueries)
+
+	source := &models.Source{
+		URI: primary.URL + "/prometheus",
+		Fallback: &models.Fallback{
+			QueryURIs:  []string{fallback.URL + "/prometheus"},
+			Strategy:   models.FallbackStrategyHedged,
+			HedgeDelay: model.Duration(50 * time.Millisecond),
+		},
+	}
+	backend, err := newQueryBackend("", source)
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, queryFallbackBackend(t, backend))
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, int64(1), primaryQueries.Load())
+	require.Equal(t, int64(1), fallbackQueries.Load())
+	// the slow endpoint is not a failing one
+	require.Equal(t, uint64(0), backend.fallback.endpoints[0].failures.Load())
+	require.Equal(t, uint64(1), backend.fallback.endpoints[1].selected.Load())
+	require.Equal(t, defaultSourceName, backend.fallback.source)
+}
@@ -4,12 +4,17 @@
 package metrics //nolint:revive,nolintlint // Package name metrics is intentional
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/prometheus/client_golang/api"
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 
 	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
 )
@@ -18,7 +23,11 @@ import (
 // the total for each mode and instance combo
 
 type GenericCollector struct {
-	v1api                    promv1.API
+	// backends the configured metrics are queried from, in the configuration order
+	backends []*queryBackend
+	// tenants queried one by one by any of the backends, their results are labeled with tenantLabel
+	tenants                  []string
+	tenantLabel              string
 	namespace                string
 	collector                *models.Collector
 	constLabels              prometheus.Labels
@@ -26,6 +35,46 @@ type GenericCollector struct {
 	warnings                 *prometheus.Desc
 	querySamples             *prometheus.Desc
 	queryLatencyMilliseconds *prometheus.Desc
+	lastSuccessTimestamp     *prometheus.Desc
+	cacheAgeSeconds          *prometheus.Desc
+	metricHealth             *metricHealth
+	// tenantHealth is nil unless the tenants of the source are queried one by one
+	tenantHealth *tenantHealth
+	// relabelRules of every configured metric, in the configuration order
+	relabelRules []relabelRules
+
+	// interval of the background evaluation, metrics are evaluated on every Collect when it is zero
+	interval time.Duration
+	mu       sync.Mutex
+	// latest evaluation results and time of the last successful one
+	cached      *evaluationResult
+	lastSuccess time.Time
+	// time of the last successful evaluation of every metric by its ID
+	metricLastSuccess map[string]time.Time
+	// time of the last successful evaluation of every tenant queried one by one
+	tenantLastSuccess map[string]time.Time
+	// last successful results of every configured metric, served while the circuit breaker of its source is open
+	metricCache [][]prometheus.Metric
+	// lifecycleMu serializes Start and Stop, it is not held by the background evaluation
+	lifecycleMu sync.Mutex
+	// cancel stops the background evaluation and its in-flight queries
+	cancel  context.CancelFunc
+	stopped sync.WaitGroup
+}
+
+// evaluationResult holds the metrics and statistics of a single evaluation of all collector metrics.
+type evaluationResult struct {
+	metrics []prometheus.Metric
+	stats   CollectStats
+	// metricStats are the statistics of every configured metric, in the configuration order
+	metricStats []CollectStats
+	// metricResults are the metrics of every configured metric, metricStale is set for the ones
+	// served from the results of an earlier evaluation
+	metricResults [][]prometheus.Metric
+	metricStale   []bool
+	// tenantStats are the statistics of the queries of every tenant queried one by one
+	tenantStats map[string]CollectStats
+	evaluatedAt time.Time
 }
 
 const (
@@ -35,16 +84,77 @@ const (
 
 var ConstLabels = [...]string{constLabelService, constLabelCustomer}
 
-func BuildCollectorsFromConfig(config *models.Configuration, customer string) ([]prometheus.Collector, error) {
-	client, err := api.NewClient(api.Config{
-		Address:      config.Source.URI,
-		RoundTripper: newMimirRoundTripper(&config.Source.Org),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error creating client: %w", err)
+var (
+	// collectorHealthSeries are the names of the health series of a collector, exported as <namespace>_<collector>_<name>,
+	// next to the health series of its metrics and of its tenants.
+	collectorHealthSeries = [...]string{"up", "warnings", "query_samples", "query_latency_milliseconds",
+		"last_success_timestamp_seconds", "cache_age_seconds",
+		"metric_up", "metric_last_success_timestamp_seconds", "metric_query_latency_milliseconds", "metric_query_samples",
+		"metric_warnings", "metric_error", "metric_stale",
+		"tenant_up", "tenant_last_success_timestamp_seconds", "tenant_query_samples", "tenant_error"}
+	// sourceHealthSeries are the names of the health series of the sources, exported as <namespace>_source_<name>.
+	sourceHealthSeries = [...]string{"query_retries_total", "circuit_state", "circuit_opened_total", "queries_rejected_total",
+		"endpoint_up", "endpoint_attempts_total", "endpoint_failures_total", "endpoint_selected_total"}
+)
+
+// SourceSubsystem is the subsystem of the health series of the sources.
+const SourceSubsystem = "source"
+
+// CollectorHealthSeriesNames returns the full names of the health series exported for the collector.
+func CollectorHealthSeriesNames(namespace, collectorName string) []string {
+	names := make([]string, len(collectorHealthSeries))
+	for i, name := range collectorHealthSeries {
+		names[i] = prometheus.BuildFQName(namespace, collectorName, name)
+	}
+	return names
+}
+
+// SourceHealthSeriesNames returns the full names of the health series exported for the sources of the namespace.
+func SourceHealthSeriesNames(namespace string) []string {
+	names := make([]string, len(sourceHealthSeries))
+	for i, name := range sourceHealthSeries {
+		names[i] = prometheus.BuildFQName(namespace, SourceSubsystem, name)
+	}
+	return names
+}
+
+// SourceName returns the name of the source the metric of the collector is queried from,
+// the source of the metric takes precedence over the source of the collector. It is empty for the default source.
+func SourceName(collector *models.Collector, metric *models.Metric) string {
+	if metric.Source != "" {
+		return metric.Source
 	}
+	return collector.Source
+}
 
-	v1api := promv1.NewAPI(client)
+func BuildCollectorsFromConfig(config *models.Configuration, customer string) ([]prometheus.Collector, error) {
+	// a backend is created for every source used by the enabled collectors, it is shared by all their metrics
+	backends := make(map[string]*queryBackend)
+	for i := range config.Collectors {
+		collector := &config.Collectors[i]
+		if !collector.Enabled {
+			continue
+		}
+		for j := range collector.Metrics {
+			name := SourceName(collector, &collector.Metrics[j])
+			if _, ok := backends[name]; ok {
+				continue
+			}
+			source := &config.Source
+			if name != "" {
+				namedSource, ok := config.Sources[name]
+				if !ok {
+					return nil, fmt.Errorf("collector %q metric %q: unknown source %q", collector.Name, collector.Metrics[j].ID, name)
+				}
+				source = &namedSource
+			}
+			backend, err := newQueryBackend(name, source)
+			if err != nil {
+				return nil, fmt.Errorf("source %q: %w", name, err)
+			}
+			backends[name] = backend
+		}
+	}
 
 	constLabels := prometheus.Labels{
 		constLabelService:  config.Namespace,
@@ -55,29 +165,108 @@ func BuildCollectorsFromConfig(config *models.Configuration, customer string) ([
 	var parsedCollectors []prometheus.Collector
 	for i := range collectors {
 		if collectors[i].Enabled {
-			collector := NewGenericCollector(v1api, config.Namespace, constLabels, &collectors[i])
+			collector, err := newGenericCollector(backends, config.Namespace, constLabels, &collectors[i])
+			if err != nil {
+				return nil, err
+			}
 			parsedCollectors = append(parsedCollectors, prometheus.Collector(collector))
 		}
 	}
+
+	var fallbacks []*fallbackRoundTripper
+	var resilientBackends []*queryBackend
+	for _, name := range slices.Sorted(maps.Keys(backends)) {
+		backend := backends[name]
+		if backend.fallback != nil {
+			fallbacks = append(fallbacks, backend.fallback)
+		}
+		if backend.retry != nil || backend.breaker != nil {
+			resilientBackends = append(resilientBackends, backend)
+		}
+	}
+	if len(fallbacks) > 0 {
+		parsedCollectors = append(parsedCollectors, newFallbackHealth(config.Namespace, constLabels, fallbacks))
+	}
+	if len(resilientBackends) > 0 {
+		parsedCollectors = append(parsedCollectors, newSourceHealth(config.Namespace, constLabels, resilientBackends))
+	}
 	return parsedCollectors, nil
 }
 
 func NewGenericCollector(v1api promv1.API, namespace string,
-	constLabels prometheus.Labels, collector *models.Collector) *GenericCollector {
-	log.Printf("NewGenericCollector(%v, %s, %v, %v)", v1api, namespace, constLabels, collector)
+	constLabels prometheus.Labels, source *models.Source, collector *models.Collector) (*GenericCollector, error) {
+	backends := map[string]*queryBackend{"": newQueryBackendForAPI(v1api, source)}
+	return newGenericCollector(backends, namespace, constLabels, collector)
+}
+
+// newGenericCollector builds the collector with the backends of the sources by name, the default source is named "".
+func newGenericCollector(backends map[string]*queryBackend, namespace string,
+	constLabels prometheus.Labels, collector *models.Collector) (*GenericCollector, error) {
+	log.Printf("NewGenericCollector(%s, %v, %v)", namespace, constLabels, collector)
+	metricBackends := make([]*queryBackend, len(collector.Metrics))
+	var tenants []string
+	tenantLabel := ""
+	for i := range collector.Metrics {
+		name := SourceName(collector, &collector.Metrics[i])
+		backend, ok := backends[name]
+		if !ok {
+			return nil, fmt.Errorf("collector %q metric %q: unknown source %q", collector.Name, collector.Metrics[i].ID, name)
+		}
+		metricBackends[i] = backend
+		if len(backend.tenants) == 0 {
+			continue
+		}
+		// the tenant health series of the collector have a single tenant label
+		if tenantLabel != "" && tenantLabel != backend.tenantLabel {
+			return nil, fmt.Errorf("collector %q: sources with tenant labels %q and %q cannot be combined",
+				collector.Name, tenantLabel, backend.tenantLabel)
+		}
+		tenantLabel = backend.tenantLabel
+		for _, tenant := range backend.tenants {
+			if !slices.Contains(tenants, tenant) {
+				tenants = append(tenants, tenant)
+			}
+		}
+	}
+	if tenantLabel != "" {
+		if err := ValidateTenantLabel(tenantLabel); err != nil {
+			return nil, fmt.Errorf("collector %q: %w", collector.Name, err)
+		}
+	}
+
+	relabelRules := make([]relabelRules, len(collector.Metrics))
 	for i := 0; i < len(collector.Metrics); i++ {
 		thisMetric := &collector.Metrics[i]
-		if len(thisMetric.DestLabels) == 0 {
-			thisMetric.Description = prometheus.NewDesc(prometheus.BuildFQName(namespace, collector.Name, thisMetric.ID),
-				thisMetric.Help, thisMetric.Labels, constLabels)
-		} else {
-			thisMetric.Description = prometheus.NewDesc(prometheus.BuildFQName(namespace, collector.Name, thisMetric.ID),
-				thisMetric.Help, thisMetric.DestLabels, constLabels)
+		backend := metricBackends[i]
+		rules, err := newRelabelRules(thisMetric.RelabelConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("collector %q metric %q: %w", collector.Name, thisMetric.ID, err)
+		}
+		relabelRules[i] = rules
+
+		variableLabels := thisMetric.DestLabels
+		if len(variableLabels) == 0 {
+			variableLabels = thisMetric.Labels
 		}
+		if len(backend.tenants) > 0 {
+			if slices.Contains(variableLabels, backend.tenantLabel) {
+				return nil, fmt.Errorf("collector %q metric %q: tenant label %q collides with a label of the metric",
+					collector.Name, thisMetric.ID, backend.tenantLabel)
+			}
+			variableLabels = append(slices.Clip(variableLabels), backend.tenantLabel)
+		}
+		metricConstLabels, err := withStaticLabels(constLabels, thisMetric.StaticLabels, variableLabels)
+		if err != nil {
+			return nil, fmt.Errorf("collector %q metric %q: %w", collector.Name, thisMetric.ID, err)
+		}
+		thisMetric.Description = prometheus.NewDesc(prometheus.BuildFQName(namespace, collector.Name, thisMetric.ID),
+			thisMetric.Help, variableLabels, metricConstLabels)
 	}
 
 	genColl := &GenericCollector{
-		v1api:       v1api,
+		backends:    metricBackends,
+		tenants:     tenants,
+		tenantLabel: tenantLabel,
 		namespace:   namespace,
 		collector:   collector,
 		constLabels: constLabels,
@@ -97,8 +286,101 @@ func NewGenericCollector(v1api promv1.API, namespace string,
 			prometheus.BuildFQName(namespace, collector.Name, "query_latency_milliseconds"),
 			"How long did it take to perform the slowest query",
 			nil, constLabels),
+		lastSuccessTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, collector.Name, "last_success_timestamp_seconds"),
+			"When were all the backend queries successful for the last time",
+			nil, constLabels),
+		cacheAgeSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, collector.Name, "cache_age_seconds"),
+			"How long ago were the exported results evaluated",
+			nil, constLabels),
+		metricHealth:      newMetricHealth(namespace, collector.Name, constLabels),
+		interval:          time.Duration(collector.EvaluationInterval),
+		metricLastSuccess: make(map[string]time.Time),
+		tenantLastSuccess: make(map[string]time.Time),
+		metricCache:       make([][]prometheus.Metric, len(collector.Metrics)),
+		relabelRules:      relabelRules,
+	}
+	if len(tenants) > 0 {
+		genColl.tenantHealth = newTenantHealth(namespace, collector.Name, tenantLabel, constLabels)
+	}
+	return genColl, nil
+}
+
+// withStaticLabels returns the const labels extended with the static labels of a metric.
+// Static labels must not collide with the const or variable labels of the metric.
+func withStaticLabels(constLabels prometheus.Labels, staticLabels map[string]string, variableLabels []string) (prometheus.Labels, error) {
+	if len(staticLabels) == 0 {
+		return constLabels, nil
+	}
+	labels := make(prometheus.Labels, len(constLabels)+len(staticLabels))
+	for name, value := range constLabels {
+		labels[name] = value
 	}
-	return genColl
+	for name, value := range staticLabels {
+		if _, ok := labels[name]; ok || slices.Contains(variableLabels, name) {
+			return nil, fmt.Errorf("static label %q collides with a label of the metric", name)
+		}
+		if !model.LegacyValidation.IsValidLabelName(name) {
+			return nil, fmt.Errorf("invalid static label name %q", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// ValidateTenantLabel checks that the tenant label can be added to the exported metrics and to the tenant health series.
+func ValidateTenantLabel(tenantLabel string) error {
+	if !model.LegacyValidation.IsValidLabelName(tenantLabel) {
+		return fmt.Errorf("invalid tenant label name %q", tenantLabel)
+	}
+	if slices.Contains(ConstLabels[:], tenantLabel) || tenantLabel == labelReason {
+		return fmt.Errorf("tenant label %q collides with a constant label", tenantLabel)
+	}
+	return nil
+}
+
+// Start starts the background evaluation of the collector metrics when an evaluation interval is configured.
+// It is a no-op when the evaluation is already running, Start and Stop can be called from any goroutine.
+func (genColl *GenericCollector) Start() {
+	genColl.lifecycleMu.Lock()
+	defer genColl.lifecycleMu.Unlock()
+	if genColl.interval <= 0 || genColl.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	genColl.cancel = cancel
+	genColl.stopped.Add(1)
+	go func() {
+		defer genColl.stopped.Done()
+		ticker := time.NewTicker(genColl.interval)
+		defer ticker.Stop()
+		for {
+			result := genColl.evaluate(ctx)
+			// results of an evaluation interrupted by Stop are dropped
+			if ctx.Err() != nil {
+				return
+			}
+			genColl.store(result)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the background evaluation, cancels its in-flight queries and waits until it returns.
+func (genColl *GenericCollector) Stop() {
+	genColl.lifecycleMu.Lock()
+	defer genColl.lifecycleMu.Unlock()
+	if genColl.cancel == nil {
+		return
+	}
+	genColl.cancel()
+	genColl.stopped.Wait()
+	genColl.cancel = nil
 }
 
 func (genColl *GenericCollector) Describe(descs chan<- *prometheus.Desc) {
@@ -109,19 +391,31 @@ func (genColl *GenericCollector) Describe(descs chan<- *prometheus.Desc) {
 }
 
 func (genColl *GenericCollector) Collect(metrics chan<- prometheus.Metric) {
-	stats := CollectStats{
-		Up:            true,
-		LatencyMillis: 0,
-		Samples:       0,
-		Warnings:      0,
+	genColl.CollectWithContext(context.Background(), metrics)
+}
+
+// CollectWithContext is Collect with the queries bound to the context, usually the one of the scrape request.
+// The context is not used when the metrics are evaluated in the background.
+func (genColl *GenericCollector) CollectWithContext(ctx context.Context, metrics chan<- prometheus.Metric) {
+	var result *evaluationResult
+	if genColl.interval > 0 {
+		genColl.mu.Lock()
+		result = genColl.cached
+		genColl.mu.Unlock()
+	} else {
+		result = genColl.evaluate(ctx)
+		genColl.store(result)
 	}
-	for i := 0; i < len(genColl.collector.Metrics); i++ {
-		metric := &genColl.collector.Metrics[i]
-		singleStat := processCounterQuery(&metric.Query, &metric.Labels,
-			metrics, genColl.v1api, genColl.collector.Metrics[i].Description,
-			genColl.collector.Metrics[i].Type)
-		reconcileStats(&stats, &singleStat)
+
+	// background evaluation has not finished yet
+	if result == nil {
+		result = &evaluationResult{}
 	}
+	for _, metric := range result.metrics {
+		metrics <- metric
+	}
+
+	stats := result.stats
 	var upf float64
 	if stats.Up {
 		upf = 1
@@ -138,6 +432,141 @@ func (genColl *GenericCollector) Collect(metrics chan<- prometheus.Metric) {
 	metrics <- prometheus.MustNewConstMetric(
 		genColl.querySamples, prometheus.GaugeValue, float64(stats.Samples),
 	)
+
+	genColl.mu.Lock()
+	lastSuccess := genColl.lastSuccess
+	metricLastSuccess := make([]time.Time, len(result.metricStats))
+	for i := range result.metricStats {
+		metricLastSuccess[i] = genColl.metricLastSuccess[genColl.collector.Metrics[i].ID]
+	}
+	genColl.mu.Unlock()
+	if !lastSuccess.IsZero() {
+		metrics <- prometheus.MustNewConstMetric(
+			genColl.lastSuccessTimestamp, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9,
+		)
+	}
+	if !result.evaluatedAt.IsZero() {
+		metrics <- prometheus.MustNewConstMetric(
+			genColl.cacheAgeSeconds, prometheus.GaugeValue, time.Since(result.evaluatedAt).Seconds(),
+		)
+	}
+	for i := range result.metricStats {
+		stale := result.metricStale[i]
+		genColl.metricHealth.collect(metrics, genColl.collector.Metrics[i].ID, &result.metricStats[i], metricLastSuccess[i], stale)
+	}
+	genColl.collectTenantHealth(metrics, result)
+}
+
+// collectTenantHealth sends the health series of every tenant queried one by one.
+func (genColl *GenericCollector) collectTenantHealth(metrics chan<- prometheus.Metric, result *evaluationResult) {
+	if genColl.tenantHealth == nil {
+		return
+	}
+	for _, tenant := range genColl.tenants {
+		stats, ok := result.tenantStats[tenant]
+		if !ok {
+			continue
+		}
+		genColl.mu.Lock()
+		lastSuccess := genColl.tenantLastSuccess[tenant]
+		genColl.mu.Unlock()
+		genColl.tenantHealth.collect(metrics, tenant, &stats, lastSuccess)
+	}
+}
+
+// evaluate runs the queries of all collector metrics and returns their results.
+func (genColl *GenericCollector) evaluate(ctx context.Context) *evaluationResult {
+	result := &evaluationResult{
+		stats: CollectStats{
+			Up:            true,
+			LatencyMillis: 0,
+			Samples:       0,
+			Warnings:      0,
+		},
+	}
+
+	ctx = withCollectorTrace(ctx, genColl.collector.Name)
+
+	// metrics are evaluated concurrently, the number of queries in flight is bounded by the backend
+	singleStats := make([]CollectStats, len(genColl.collector.Metrics))
+	evaluations := make([]*metricEvaluation, len(genColl.collector.Metrics))
+	result.metricResults = make([][]prometheus.Metric, len(genColl.collector.Metrics))
+	var wg sync.WaitGroup
+	for i := 0; i < len(genColl.collector.Metrics); i++ {
+		metric := &genColl.collector.Metrics[i]
+		metrics := make(chan prometheus.Metric)
+		evaluations[i] = newMetricEvaluation(ctx, metric, genColl.relabelRules[i], genColl.backends[i], metrics)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for metric := range metrics {
+				result.metricResults[i] = append(result.metricResults[i], metric)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			singleStats[i] = processMetric(evaluations[i])
+			close(metrics)
+		}()
+	}
+	wg.Wait()
+
+	// the metrics rejected by the circuit breaker of their source are served from their last successful results
+	result.metricStale = make([]bool, len(genColl.collector.Metrics))
+	genColl.mu.Lock()
+	for i := range singleStats {
+		if singleStats[i].ErrorReason == errorReasonCircuitOpen && genColl.metricCache[i] != nil {
+			result.metricResults[i] = genColl.metricCache[i]
+			result.metricStale[i] = true
+		}
+	}
+	genColl.mu.Unlock()
+	for i := range result.metricResults {
+		result.metrics = append(result.metrics, result.metricResults[i]...)
+	}
+
+	for i := range singleStats {
+		reconcileStats(&result.stats, &singleStats[i])
+	}
+	result.metricStats = singleStats
+	if len(genColl.tenants) > 0 {
+		result.tenantStats = make(map[string]CollectStats, len(genColl.tenants))
+		for _, evaluation := range evaluations {
+			for tenant, stats := range evaluation.tenantStats {
+				tenantStats, ok := result.tenantStats[tenant]
+				if !ok {
+					tenantStats = CollectStats{Up: true}
+				}
+				reconcileStats(&tenantStats, &stats)
+				result.tenantStats[tenant] = tenantStats
+			}
+		}
+	}
+	result.evaluatedAt = time.Now()
+	return result
+}
+
+// store saves the evaluation results served by Collect in the background evaluation mode.
+func (genColl *GenericCollector) store(result *evaluationResult) {
+	genColl.mu.Lock()
+	defer genColl.mu.Unlock()
+	if genColl.interval > 0 {
+		genColl.cached = result
+	}
+	if result.stats.Up {
+		genColl.lastSuccess = result.evaluatedAt
+	}
+	for i := range result.metricStats {
+		if result.metricStats[i].Up {
+			genColl.metricLastSuccess[genColl.collector.Metrics[i].ID] = result.evaluatedAt
+			genColl.metricCache[i] = result.metricResults[i]
+		}
+	}
+	for tenant, stats := range result.tenantStats {
+		if stats.Up {
+			genColl.tenantLastSuccess[tenant] = result.evaluatedAt
+		}
+	}
 }
 
 func reconcileStats(mainStats *CollectStats, singleStat *CollectStats) {
@@ -147,4 +576,7 @@ func reconcileStats(mainStats *CollectStats, singleStat *CollectStats) {
 	}
 	mainStats.Samples += singleStat.Samples
 	mainStats.Warnings += singleStat.Warnings
+	if mainStats.ErrorReason == "" {
+		mainStats.ErrorReason = singleStat.ErrorReason
+	}
 }
@@ -4,17 +4,23 @@
 package metrics //nolint:revive,nolintlint // Package name metrics is intentional
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -142,6 +148,9 @@ func TestCollector(t *testing.T) {
 						// query responses baselines as files
 						queryResponses: map[string]string{
 							"traefik_service_requests_total":                   "orch_traefik_service_requests_total.json",
+							"traefik_service_request_duration_seconds_bucket":  "orch_traefik_service_request_duration_seconds_bucket.json",
+							"traefik_service_request_duration_seconds_sum":     "orch_traefik_service_request_duration_seconds_sum.json",
+							"traefik_service_request_duration_seconds_count":   "orch_traefik_service_request_duration_seconds_count.json",
 							"sum by(k8s_node_name) (k8s_node_allocatable_cpu)": "orch_cpu_total_cores.json",
 							"sum by(k8s_node_name) (k8s_node_cpu_usage)":       "orch_cpu_used_cores.json",
 							"k8s_node_allocatable_memory":                      "orch_memory_total_bytes.json",
@@ -287,7 +296,7 @@ func TestCollector(t *testing.T) {
 						},
 					},
 				},
-				// In expected output we put 100ms latency because of nondeterministic fluctioation of few ms.
+				// The latency values vary with scheduling, they are checked against the mock server latency below.
 				expectedOutputsFile: "expected_outputs_latency.txt",
 				svrReturnCode:       200,
 				latency:             1 * time.Second,
@@ -388,6 +397,727 @@ func TestCollector(t *testing.T) {
 					"The server response does not contain the expected substring: \n%s\n\n==== Response received below ====\n%s\n",
 					substr, response)
 			}
+			if tt.arguments.serverOn && tt.arguments.latency != 0 {
+				requireQueryLatency(t, response, tt.arguments.latency)
+			}
+		})
+	}
+}
+
+// requireQueryLatency checks that every query latency series of the response reports at least the latency
+// of the mock server, with a generous upper bound for slow test runs.
+func requireQueryLatency(t *testing.T, response string, latency time.Duration) {
+	t.Helper()
+	minimum := float64(latency.Milliseconds())
+	found := 0
+	for _, line := range strings.Split(response, "\n") {
+		if strings.HasPrefix(line, "#") || !strings.Contains(line, "_query_latency_milliseconds{") {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64)
+		require.NoError(t, err)
+		require.GreaterOrEqualf(t, value, minimum, "unexpected latency: %s", line)
+		require.Lessf(t, value, 10*minimum, "unexpected latency: %s", line)
+		found++
+	}
+	require.NotZero(t, found, "no query latency series in the response")
+}
+
+// gatherMetricFamilies builds collectors of a single collector configuration against the mock server
+// and returns the gathered metric families by name.
+func gatherMetricFamilies(t *testing.T, queryResponses map[string]string, metrics ...models.Metric) map[string]*dto.MetricFamily {
+	org := "test-org"
+	mockServer := setupMockServer(t, queryResponses, org, 200, 0)
+	defer mockServer.Close()
+
+	return gatherMetricFamiliesFromSource(t, models.Source{URI: mockServer.URL, Org: org}, metrics...)
+}
+
+func gatherMetricFamiliesFromSource(t *testing.T, source models.Source, metrics ...models.Metric) map[string]*dto.MetricFamily {
+	return gatherConfig(t, &models.Configuration{
+		Namespace: "orch",
+		Source:    source,
+		Collectors: []models.Collector{
+			{
+				Name:    "api",
+				Enabled: true,
+				Metrics: metrics,
+			},
+		},
+	})
+}
+
+// gatherConfig builds the collectors of the configuration into a pipeline and returns the gathered metric families by name.
+func gatherConfig(t *testing.T, config *models.Configuration) map[string]*dto.MetricFamily {
+	collectors, err := BuildCollectorsFromConfig(config, "test-customer")
+	require.NoError(t, err)
+	ppl := NewPipeline()
+	ppl.AddCollectors(collectors...)
+	return gatherFamilies(t, ppl.registry)
+}
+
+func gatherFamilies(t *testing.T, gatherer prometheus.Gatherer) map[string]*dto.MetricFamily {
+	families, err := gatherer.Gather()
+	require.NoError(t, err)
+	familiesByName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		familiesByName[family.GetName()] = family
+	}
+	return familiesByName
+}
+
+// setupQueryServer returns a mock server answering every query with the status code and the body returned by respond.
+// Nothing is written once the request is canceled.
+func setupQueryServer(t *testing.T, respond func(req *http.Request) (int, string)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, req.ParseForm())
+		code, body := respond(req)
+		if req.Context().Err() != nil {
+			return
+		}
+		rw.WriteHeader(code)
+		_, err := rw.Write([]byte(body))
+		assert.NoError(t, err)
+	}))
+}
+
+// newCPUCoresMetric returns a gauge of the CPU cores per node, as answered by orch_cpu_total_cores.json.
+func newCPUCoresMetric(id, query string) models.Metric {
+	return models.Metric{
+		Query:  query,
+		ID:     id,
+		Help:   "Total CPU cores per node",
+		Labels: []string{"k8s_node_name"},
+		Type:   models.MetricTypeGauge,
+	}
+}
+
+// metricsByLabel returns the metrics of the family by the value of the label.
+func metricsByLabel(t *testing.T, family *dto.MetricFamily, name string) map[string]*dto.Metric {
+	require.NotNil(t, family)
+	result := make(map[string]*dto.Metric)
+	for _, m := range family.GetMetric() {
+		if value, ok := labelValue(m, name); ok {
+			result[value] = m
+		}
+	}
+	return result
+}
+
+func labelValue(m *dto.Metric, name string) (string, bool) {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+func TestCollectorNativeHistogram(t *testing.T) {
+	const query = "sum by(handler) (http_request_duration_seconds)"
+	values := gatherMetricFamilies(t, map[string]string{query: "orch_request_duration_native.json"},
+		models.Metric{
+			Query:  query,
+			ID:     "request_duration_seconds",
+			Help:   "Native histogram of HTTP request durations",
+			Labels: []string{"handler"},
+			Type:   models.MetricTypeNativeHistogram,
+		})
+
+	family := values["orch_api_request_duration_seconds"]
+	require.NotNil(t, family)
+	require.Equal(t, dto.MetricType_HISTOGRAM, family.GetType())
+	// the float sample of the "ui" handler is skipped
+	require.Len(t, family.GetMetric(), 1)
+
+	histogram := family.GetMetric()[0].GetHistogram()
+	require.Equal(t, uint64(10), histogram.GetSampleCount())
+	require.InDelta(t, 12.5, histogram.GetSampleSum(), 1e-9)
+	require.Equal(t, int32(0), histogram.GetSchema())
+	require.InDelta(t, 0.001, histogram.GetZeroThreshold(), 1e-9)
+	require.Equal(t, uint64(1), histogram.GetZeroCount())
+	// positive buckets with index 0 and 1, counts are delta encoded
+	require.Len(t, histogram.GetPositiveSpan(), 1)
+	require.Equal(t, int32(0), histogram.GetPositiveSpan()[0].GetOffset())
+	require.Equal(t, []int64{4, -1}, histogram.GetPositiveDelta())
+	// negative bucket with index 1
+	require.Len(t, histogram.GetNegativeSpan(), 1)
+	require.Equal(t, int32(1), histogram.GetNegativeSpan()[0].GetOffset())
+	require.Equal(t, []int64{2}, histogram.GetNegativeDelta())
+
+	require.InDelta(t, 0, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.InDelta(t, 2, values["orch_api_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorNativeHistogramFractionalCounts(t *testing.T) {
+	const query = "sum by(handler) (rate(http_request_duration_seconds[5m]))"
+	values := gatherMetricFamilies(t, map[string]string{query: "orch_request_duration_native_rate.json"},
+		models.Metric{
+			Query:  query,
+			ID:     "request_duration_seconds",
+			Help:   "Native histogram of HTTP request durations",
+			Labels: []string{"handler"},
+			Type:   models.MetricTypeNativeHistogram,
 		})
+
+	// fractional counts cannot be exported without loss, the sample is rejected
+	require.Nil(t, values["orch_api_request_duration_seconds"])
+	require.InDelta(t, 0, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.InDelta(t, 1, values["orch_api_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorSummary(t *testing.T) {
+	values := gatherMetricFamilies(t,
+		map[string]string{
+			"http_request_duration_quantiles": "orch_request_duration_quantiles.json",
+			"http_request_duration_p99":       "orch_request_duration_p99.json",
+			"http_request_duration_sum":       "orch_request_duration_sum.json",
+			"http_request_duration_count":     "orch_request_duration_count.json",
+		},
+		models.Metric{
+			Query:           "http_request_duration_quantiles",
+			QuantileQueries: map[string]string{"0.99": "http_request_duration_p99"},
+			SumQuery:        "http_request_duration_sum",
+			CountQuery:      "http_request_duration_count",
+			ID:              "request_duration_seconds",
+			Help:            "Summary of HTTP request durations",
+			Labels:          []string{"handler"},
+			Type:            models.MetricTypeSummary,
+		})
+
+	family := values["orch_api_request_duration_seconds"]
+	require.NotNil(t, family)
+	require.Equal(t, dto.MetricType_SUMMARY, family.GetType())
+	require.Len(t, family.GetMetric(), 1)
+
+	summary := family.GetMetric()[0].GetSummary()
+	require.Equal(t, uint64(214), summary.GetSampleCount())
+	require.InDelta(t, 23.5, summary.GetSampleSum(), 1e-9)
+	quantiles := make(map[float64]float64)
+	for _, quantile := range summary.GetQuantile() {
+		quantiles[quantile.GetQuantile()] = quantile.GetValue()
+	}
+	require.Equal(t, map[float64]float64{0.5: 0.12, 0.9: 0.48, 0.99: 0.97}, quantiles)
+
+	require.InDelta(t, 1, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.InDelta(t, 5, values["orch_api_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorRangeEvaluation(t *testing.T) {
+	const query = "sum by(k8s_node_name) (k8s_node_cpu_usage)"
+	values := gatherMetricFamilies(t, map[string]string{query: "orch_cpu_used_cores_range.json"},
+		models.Metric{
+			Query:  query,
+			ID:     "cpu_used_cores_max",
+			Help:   "Maximum of used CPU cores per node over the last day",
+			Labels: []string{"k8s_node_name"},
+			Type:   models.MetricTypeGauge,
+			Evaluation: &models.Evaluation{
+				Range:       model.Duration(24 * time.Hour),
+				Step:        model.Duration(30 * time.Second),
+				Aggregation: models.AggregationMax,
+			},
+		})
+
+	maxValues := make(map[string]float64)
+	for node, m := range metricsByLabel(t, values["orch_api_cpu_used_cores_max"], "k8s_node_name") {
+		maxValues[node] = m.GetGauge().GetValue()
+	}
+	require.Equal(t, map[string]float64{
+		"ip-10-250-2-47.us-west-2.compute.internal":   2.5,
+		"ip-10-250-26-105.us-west-2.compute.internal": 4,
+	}, maxValues)
+	require.InDelta(t, 1, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorEvaluationDelay(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	queryTimes := make(chan string, 1)
+	mockServer := setupQueryServer(t, func(req *http.Request) (int, string) {
+		queryTimes <- req.Form.Get("time")
+		return http.StatusOK, response
+	})
+	defer mockServer.Close()
+
+	source := models.Source{
+		URI:              mockServer.URL,
+		Org:              "test-org",
+		EvaluationDelay:  model.Duration(5 * time.Minute),
+		ExportTimestamps: true,
+	}
+	metricDelay := model.Duration(2 * time.Minute)
+	metric := newCPUCoresMetric("cpu_total_cores", "sum by(k8s_node_name) (k8s_node_allocatable_cpu)")
+	metric.EvaluationDelay = &metricDelay
+	values := gatherMetricFamiliesFromSource(t, source, metric)
+
+	queryTime, err := strconv.ParseFloat(<-queryTimes, 64)
+	require.NoError(t, err)
+	// the delay of the metric overrides the delay of the source
+	expectedTime := time.Now().Add(-2 * time.Minute)
+	require.InDelta(t, float64(expectedTime.Unix()), queryTime, 10)
+
+	t.Run("metric without delay", func(t *testing.T) {
+		var noDelay model.Duration
+		metric := metric
+		metric.EvaluationDelay = &noDelay
+		gatherMetricFamiliesFromSource(t, source, metric)
+		queryTime, err := strconv.ParseFloat(<-queryTimes, 64)
+		require.NoError(t, err)
+		require.InDelta(t, float64(time.Now().Unix()), queryTime, 10)
+	})
+
+	family := values["orch_api_cpu_total_cores"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 4)
+	for _, m := range family.GetMetric() {
+		require.InDelta(t, queryTime*1000, float64(m.GetTimestampMs()), 1)
+	}
+	// collector health metrics are not stamped
+	require.Zero(t, values["orch_api_up"].GetMetric()[0].GetTimestampMs())
+}
+
+func TestCollectorBackgroundEvaluation(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	var requests atomic.Int32
+	mockServer := setupQueryServer(t, func(_ *http.Request) (int, string) {
+		requests.Add(1)
+		return http.StatusOK, response
+	})
+	defer mockServer.Close()
+
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    models.Source{URI: mockServer.URL, Org: "test-org"},
+		Collectors: []models.Collector{
+			{
+				Name:               "api",
+				Enabled:            true,
+				Metrics:            []models.Metric{newCPUCoresMetric("cpu_total_cores", "sum by(k8s_node_name) (k8s_node_allocatable_cpu)")},
+				EvaluationInterval: model.Duration(50 * time.Millisecond),
+			},
+		},
+	}
+	collectors, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.NoError(t, err)
+	require.Len(t, collectors, 1)
+	genColl, ok := collectors[0].(*GenericCollector)
+	require.True(t, ok)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(genColl)
+
+	// nothing is evaluated before the collector is started
+	familiesByName := gatherFamilies(t, registry)
+	require.NotContains(t, familiesByName, "orch_api_cpu_total_cores")
+	require.InDelta(t, 0, familiesByName["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.Zero(t, requests.Load())
+
+	genColl.Start()
+	require.Eventually(t, func() bool { return requests.Load() >= 3 }, 5*time.Second, 10*time.Millisecond)
+
+	// scrapes do not trigger queries, cached results are served
+	genColl.Stop()
+	requestsAfterStop := requests.Load()
+	familiesByName = gatherFamilies(t, registry)
+	require.Equal(t, requestsAfterStop, requests.Load())
+	require.Len(t, familiesByName["orch_api_cpu_total_cores"].GetMetric(), 4)
+	require.InDelta(t, 1, familiesByName["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	lastSuccess := familiesByName["orch_api_last_success_timestamp_seconds"].GetMetric()[0].GetGauge().GetValue()
+	require.InDelta(t, float64(time.Now().Unix()), lastSuccess, 5)
+	require.GreaterOrEqual(t, familiesByName["orch_api_cache_age_seconds"].GetMetric()[0].GetGauge().GetValue(), 0.0)
+
+	t.Run("concurrent start and stop", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				genColl.Start()
+			}()
+			go func() {
+				defer wg.Done()
+				genColl.Stop()
+			}()
+		}
+		wg.Wait()
+		genColl.Stop()
+		genColl.lifecycleMu.Lock()
+		defer genColl.lifecycleMu.Unlock()
+		require.Nil(t, genColl.cancel)
+	})
+}
+
+func TestCollectorConcurrentQueries(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	var inFlight, maxInFlight, requests atomic.Int32
+	mockServer := setupQueryServer(t, func(_ *http.Request) (int, string) {
+		requests.Add(1)
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return http.StatusOK, response
+	})
+	defer mockServer.Close()
+
+	newCollector := func(name string) models.Collector {
+		collector := models.Collector{Name: name, Enabled: true}
+		for i := range 3 {
+			collector.Metrics = append(collector.Metrics,
+				newCPUCoresMetric("cpu_total_cores_"+strconv.Itoa(i), "sum by(k8s_node_name) (k8s_node_allocatable_cpu)"))
+		}
+		return collector
+	}
+	familiesByName := gatherConfig(t, &models.Configuration{
+		Namespace:  "orch",
+		Source:     models.Source{URI: mockServer.URL, Org: "test-org", MaxConcurrentQueries: 2},
+		Collectors: []models.Collector{newCollector("api"), newCollector("edge")},
+	})
+
+	// the limit of the source is shared by the collectors gathered concurrently
+	require.Equal(t, int32(6), requests.Load())
+	require.Equal(t, int32(2), maxInFlight.Load())
+	for _, name := range []string{"api", "edge"} {
+		for i := range 3 {
+			require.Len(t, familiesByName["orch_"+name+"_cpu_total_cores_"+strconv.Itoa(i)].GetMetric(), 4)
+		}
+		require.InDelta(t, 1, familiesByName["orch_"+name+"_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+		require.InDelta(t, 12, familiesByName["orch_"+name+"_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+		require.GreaterOrEqual(t, familiesByName["orch_"+name+"_query_latency_milliseconds"].GetMetric()[0].GetGauge().GetValue(), 50.0)
+	}
+}
+
+func TestCollectorQueryTimeout(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	timeouts := make(chan string, 2)
+	mockServer := setupQueryServer(t, func(req *http.Request) (int, string) {
+		timeouts <- req.Form.Get("timeout")
+		if req.Form.Get("query") == "slow" {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return http.StatusOK, response
+	})
+	defer mockServer.Close()
+
+	slow := newCPUCoresMetric("cpu_slow_cores", "slow")
+	slow.QueryTimeout = model.Duration(100 * time.Millisecond)
+	source := models.Source{URI: mockServer.URL, Org: "test-org", QueryTimeout: model.Duration(3 * time.Second)}
+	start := time.Now()
+	values := gatherMetricFamiliesFromSource(t, source,
+		newCPUCoresMetric("cpu_total_cores", "sum by(k8s_node_name) (k8s_node_allocatable_cpu)"), slow)
+
+	// the slow query is cancelled after the timeout of the metric
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.ElementsMatch(t, []string{"3s", "100ms"}, []string{<-timeouts, <-timeouts})
+	require.Len(t, values["orch_api_cpu_total_cores"].GetMetric(), 4)
+	require.NotContains(t, values, "orch_api_cpu_slow_cores")
+	require.InDelta(t, 0, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorCollectWithContext(t *testing.T) {
+	var requests atomic.Int32
+	mockServer := setupQueryServer(t, func(_ *http.Request) (int, string) {
+		requests.Add(1)
+		return http.StatusOK, metricsEmptyResponse
+	})
+	defer mockServer.Close()
+
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    models.Source{URI: mockServer.URL, Org: "test-org"},
+		Collectors: []models.Collector{
+			{
+				Name:    "api",
+				Enabled: true,
+				Metrics: []models.Metric{newCPUCoresMetric("cpu_total_cores", "sum by(k8s_node_name) (k8s_node_allocatable_cpu)")},
+			},
+		},
+	}
+	collectors, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.NoError(t, err)
+	genColl, ok := collectors[0].(*GenericCollector)
+	require.True(t, ok)
+
+	// queries of a cancelled scrape are not sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	metrics := make(chan prometheus.Metric, 16)
+	genColl.CollectWithContext(ctx, metrics)
+	close(metrics)
+	require.Zero(t, requests.Load())
+	var up dto.Metric
+	require.NoError(t, (<-metrics).Write(&up))
+	require.InDelta(t, 0, up.GetGauge().GetValue(), 0)
+}
+
+func TestCollectorMetricHealth(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	mockServer := setupQueryServer(t, func(req *http.Request) (int, string) {
+		switch req.Form.Get("query") {
+		case "unavailable":
+			return http.StatusBadGateway, "upstream unavailable"
+		case "invalid":
+			return http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error"}`
+		case "slow":
+			<-req.Context().Done()
+		}
+		return http.StatusOK, response
+	})
+	defer mockServer.Close()
+
+	const query = "sum by(k8s_node_name) (k8s_node_allocatable_cpu)"
+	metrics := []models.Metric{
+		newCPUCoresMetric("cpu_total_cores", query),
+		newCPUCoresMetric("cpu_unavailable", "unavailable"),
+		newCPUCoresMetric("cpu_invalid", "invalid"),
+		newCPUCoresMetric("cpu_slow", "slow"),
+		newCPUCoresMetric("cpu_unknown", query),
+	}
+	metrics[4].Type = "Info"
+	for i := range metrics {
+		metrics[i].QueryTimeout = model.Duration(200 * time.Millisecond)
+	}
+	values := gatherMetricFamiliesFromSource(t, models.Source{URI: mockServer.URL, Org: "test-org"}, metrics...)
+
+	byMetric := func(name string) map[string]*dto.Metric {
+		return metricsByLabel(t, values[name], labelMetric)
+	}
+	up := byMetric("orch_api_metric_up")
+	require.Len(t, up, 5)
+	require.InDelta(t, 1, up["cpu_total_cores"].GetGauge().GetValue(), 0)
+	for _, id := range []string{"cpu_unavailable", "cpu_invalid", "cpu_slow", "cpu_unknown"} {
+		require.InDelta(t, 0, up[id].GetGauge().GetValue(), 0, id)
+	}
+	require.InDelta(t, 4, byMetric("orch_api_metric_query_samples")["cpu_total_cores"].GetGauge().GetValue(), 0)
+	require.InDelta(t, 0, byMetric("orch_api_metric_warnings")["cpu_total_cores"].GetGauge().GetValue(), 0)
+	require.Len(t, byMetric("orch_api_metric_query_latency_milliseconds"), 5)
+
+	lastSuccess := byMetric("orch_api_metric_last_success_timestamp_seconds")
+	require.Len(t, lastSuccess, 1)
+	require.InDelta(t, float64(time.Now().Unix()), lastSuccess["cpu_total_cores"].GetGauge().GetValue(), 5)
+
+	reasons := make(map[string]string)
+	for id, m := range byMetric("orch_api_metric_error") {
+		require.InDelta(t, 1, m.GetGauge().GetValue(), 0)
+		reasons[id], _ = labelValue(m, labelReason)
+	}
+	require.Equal(t, map[string]string{
+		"cpu_unavailable": "http_502",
+		"cpu_invalid":     errorReasonBadData,
+		"cpu_slow":        errorReasonTimeout,
+		"cpu_unknown":     errorReasonUnknownType,
+	}, reasons)
+	require.InDelta(t, 0, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorLabelTransform(t *testing.T) {
+	const query = "avg by(host, hostGuid, sensor) (temp_temp)"
+	redacted := "redacted"
+	metric := models.Metric{
+		Query:      query,
+		ID:         "temp",
+		Help:       "Temperature of a sensor on Edge Node host [Celsius]",
+		Labels:     []string{"hostGuid", "core", "host"},
+		DestLabels: []string{"hostGuid", "core", "node"},
+		Type:       models.MetricTypeGauge,
+		RelabelConfigs: []models.RelabelConfig{
+			{SourceLabels: []string{"sensor"}, Regex: "coretemp_core_(0|1)", Action: models.RelabelKeep},
+			{SourceLabels: []string{"sensor"}, Regex: "coretemp_(.+)", TargetLabel: "core"},
+			{SourceLabels: []string{"hostGuid"}, TargetLabel: "hostGuid", Action: models.RelabelHash},
+			{SourceLabels: []string{"host"}, Regex: ".+", TargetLabel: "host", Replacement: &redacted},
+		},
+		StaticLabels: map[string]string{"region": "eu"},
+	}
+	values := gatherMetricFamilies(t, map[string]string{query: "edgenode_temp_temp.json"}, metric)
+
+	family := values["orch_api_temp"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 2)
+	for i, m := range family.GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		require.Equal(t, map[string]string{
+			"core":     "core_" + strconv.Itoa(i),
+			"customer": "test-customer",
+			"hostGuid": "1940abf45d3610f8135ea65af7a8873c1c0a2a5d99107c915b0f772f582ac968",
+			"node":     "redacted",
+			"region":   "eu",
+			"service":  "orch",
+		}, labels)
+	}
+	require.InDelta(t, 2, values["orch_api_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+}
+
+func TestCollectorStaticLabelsConflict(t *testing.T) {
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    models.Source{URI: "http://localhost", Org: "test-org"},
+		Collectors: []models.Collector{
+			{
+				Name:    "api",
+				Enabled: true,
+				Metrics: []models.Metric{
+					{
+						Query:        "up",
+						ID:           "up_targets",
+						Labels:       []string{"job"},
+						Type:         models.MetricTypeGauge,
+						StaticLabels: map[string]string{"service": "other"},
+					},
+				},
+			},
+		},
 	}
+	_, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `static label "service"`)
+
+	config.Collectors[0].Metrics[0].StaticLabels = map[string]string{"job": "other"}
+	_, err = BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `static label "job"`)
+
+	config.Collectors[0].Metrics[0].StaticLabels = nil
+	config.Collectors[0].Metrics[0].RelabelConfigs = []models.RelabelConfig{{Action: "unknown"}}
+	_, err = BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, "unknown action")
+}
+
+func TestCollectorPerTenant(t *testing.T) {
+	response := readFileContents(t, path.Join(pathToTestGenCollectorInputData, "orch_cpu_total_cores.json"))
+	mockServer := setupQueryServer(t, func(req *http.Request) (int, string) {
+		switch req.Header.Get(HeaderXScopeOrgID) {
+		case "tenant-a", "tenant-b":
+			return http.StatusOK, response
+		default:
+			return http.StatusBadGateway, "upstream unavailable"
+		}
+	})
+	defer mockServer.Close()
+
+	source := models.Source{
+		URI:         mockServer.URL,
+		Org:         "tenant-a|tenant-b|broken",
+		TenantMode:  models.TenantModePerTenant,
+		TenantLabel: "projectId",
+	}
+	values := gatherMetricFamiliesFromSource(t, source,
+		newCPUCoresMetric("cpu_total_cores", "sum by(k8s_node_name) (k8s_node_allocatable_cpu)"))
+	byTenant := func(name string) map[string]*dto.Metric {
+		return metricsByLabel(t, values[name], "projectId")
+	}
+
+	family := values["orch_api_cpu_total_cores"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 8)
+	tenants := make(map[string]int)
+	for _, m := range family.GetMetric() {
+		if tenant, ok := labelValue(m, "projectId"); ok {
+			tenants[tenant]++
+		}
+	}
+	require.Equal(t, map[string]int{"tenant-a": 4, "tenant-b": 4}, tenants)
+
+	// the broken tenant does not mark the collector down
+	require.InDelta(t, 1, values["orch_api_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.InDelta(t, 8, values["orch_api_query_samples"].GetMetric()[0].GetGauge().GetValue(), 0)
+
+	up := byTenant("orch_api_tenant_up")
+	require.Len(t, up, 3)
+	require.InDelta(t, 1, up["tenant-a"].GetGauge().GetValue(), 0)
+	require.InDelta(t, 1, up["tenant-b"].GetGauge().GetValue(), 0)
+	require.InDelta(t, 0, up["broken"].GetGauge().GetValue(), 0)
+	require.InDelta(t, 4, byTenant("orch_api_tenant_query_samples")["tenant-a"].GetGauge().GetValue(), 0)
+	require.Len(t, byTenant("orch_api_tenant_last_success_timestamp_seconds"), 2)
+
+	tenantErrors := byTenant("orch_api_tenant_error")
+	require.Len(t, tenantErrors, 1)
+	require.NotNil(t, tenantErrors["broken"])
+	reason, _ := labelValue(tenantErrors["broken"], labelReason)
+	require.Equal(t, "http_502", reason)
+}
+
+func TestCollectorPerTenantLabelConflict(t *testing.T) {
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    models.Source{URI: "http://localhost", Org: "tenant-a|tenant-b", TenantMode: models.TenantModePerTenant},
+		Collectors: []models.Collector{
+			{
+				Name:    "api",
+				Enabled: true,
+				Metrics: []models.Metric{
+					{
+						Query:  "up",
+						ID:     "up_targets",
+						Labels: []string{"tenant"},
+						Type:   models.MetricTypeGauge,
+					},
+				},
+			},
+		},
+	}
+	_, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `tenant label "tenant" collides`)
+
+	config.Collectors[0].Metrics[0].Labels = []string{"job"}
+	config.Source.TenantLabel = "customer"
+	_, err = BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `tenant label "customer" collides`)
+
+	config.Source.TenantLabel = "job"
+	_, err = BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `tenant label "job" collides`)
+}
+
+func TestCollectorNamedSources(t *testing.T) {
+	const (
+		edgeQuery     = "sum by(k8s_node_name) (edge_node_cpu)"
+		platformQuery = "sum by(k8s_node_name) (k8s_node_allocatable_cpu)"
+	)
+	edgeServer := setupMockServer(t, map[string]string{edgeQuery: "orch_cpu_total_cores.json"}, "edge-org", 200, 0)
+	defer edgeServer.Close()
+	platformServer := setupMockServer(t, map[string]string{platformQuery: "orch_cpu_total_cores.json"}, "platform-org", 200, 0)
+	defer platformServer.Close()
+
+	platformMetric := newCPUCoresMetric("platform_cpu_cores", platformQuery)
+	platformMetric.Source = "platform"
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    models.Source{URI: edgeServer.URL, Org: "edge-org"},
+		Sources: map[string]models.Source{
+			"platform": {URI: platformServer.URL, Org: "platform-org"},
+		},
+		Collectors: []models.Collector{
+			{
+				Name:    "edge",
+				Enabled: true,
+				Metrics: []models.Metric{newCPUCoresMetric("cpu_cores", edgeQuery), platformMetric},
+			},
+			{
+				Name:    "platform",
+				Enabled: true,
+				Source:  "platform",
+				Metrics: []models.Metric{newCPUCoresMetric("cpu_cores", platformQuery)},
+			},
+		},
+	}
+	values := gatherConfig(t, &config)
+	for _, name := range []string{"orch_edge_cpu_cores", "orch_edge_platform_cpu_cores", "orch_platform_cpu_cores"} {
+		require.NotNil(t, values[name], name)
+		require.Len(t, values[name].GetMetric(), 4, name)
+	}
+	require.InDelta(t, 1, values["orch_edge_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+	require.InDelta(t, 1, values["orch_platform_up"].GetMetric()[0].GetGauge().GetValue(), 0)
+
+	config.Collectors[1].Source = "missing"
+	_, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.ErrorContains(t, err, `collector "platform" metric "cpu_cores": unknown source "missing"`)
 }
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values of the reason label of the metric error series.
+const (
+	errorReasonTimeout     = "timeout"
+	errorReasonCanceled    = "canceled"
+	errorReasonBadData     = "bad_data"
+	errorReasonUnknownType = "unknown_type"
+	errorReasonUnavailable = "unavailable"
+	// errorReasonCircuitOpen is set when the query was not sent because the circuit breaker of the source is open.
+	errorReasonCircuitOpen = "circuit_open"
+	// errorReasonHTTPPrefix is followed by the HTTP status code of the failed query.
+	errorReasonHTTPPrefix = "http_"
+
+	labelMetric = "metric"
+	labelReason = "reason"
+)
+
+// metricHealth describes the health series exported for every configured metric of a collector.
+type metricHealth struct {
+	up                       *prometheus.Desc
+	lastSuccessTimestamp     *prometheus.Desc
+	queryLatencyMilliseconds *prometheus.Desc
+	querySamples             *prometheus.Desc
+	warnings                 *prometheus.Desc
+	errors                   *prometheus.Desc
+	stale                    *prometheus.Desc
+}
+
+func newMetricHealth(namespace, subsystem string, constLabels prometheus.Labels) *metricHealth {
+	return &metricHealth{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_up"),
+			"Were the last queries of the metric successful",
+			[]string{labelMetric}, constLabels),
+		lastSuccessTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_last_success_timestamp_seconds"),
+			"When were the queries of the metric successful for the last time",
+			[]string{labelMetric}, constLabels),
+		queryLatencyMilliseconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_query_latency_milliseconds"),
+			"How long did it take to perform the slowest query of the metric",
+			[]string{labelMetric}, constLabels),
+		querySamples: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_query_samples"),
+			"How many samples did the last queries of the metric generate",
+			[]string{labelMetric}, constLabels),
+		warnings: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_warnings"),
+			"How many warnings did the last queries of the metric generate",
+			[]string{labelMetric}, constLabels),
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_error"),
+			"Why did the last queries of the metric fail, exported only for failing metrics",
+			[]string{labelMetric, labelReason}, constLabels),
+		stale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "metric_stale"),
+			"Are the exported samples of the metric the results of its last successful queries, "+
+				"exported only while the circuit breaker of the source is open",
+			[]string{labelMetric}, constLabels),
+	}
+}
+
+// collect sends the health series of the metric, stale is set when its samples were served from an earlier evaluation.
+func (health *metricHealth) collect(metrics chan<- prometheus.Metric, id string, stats *CollectStats, lastSuccess time.Time, stale bool) {
+	var upf float64
+	if stats.Up {
+		upf = 1
+	}
+	metrics <- prometheus.MustNewConstMetric(health.up, prometheus.GaugeValue, upf, id)
+	metrics <- prometheus.MustNewConstMetric(
+		health.queryLatencyMilliseconds, prometheus.GaugeValue, float64(stats.LatencyMillis), id)
+	metrics <- prometheus.MustNewConstMetric(health.querySamples, prometheus.GaugeValue, float64(stats.Samples), id)
+	metrics <- prometheus.MustNewConstMetric(health.warnings, prometheus.GaugeValue, float64(stats.Warnings), id)
+	if !lastSuccess.IsZero() {
+		metrics <- prometheus.MustNewConstMetric(
+			health.lastSuccessTimestamp, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9, id)
+	}
+	if !stats.Up && stats.ErrorReason != "" {
+		metrics <- prometheus.MustNewConstMetric(health.errors, prometheus.GaugeValue, 1, id, stats.ErrorReason)
+	}
+	if stale {
+		metrics <- prometheus.MustNewConstMetric(health.stale, prometheus.GaugeValue, 1, id)
+	}
+}
+
+// tenantHealth describes the health series exported for every tenant queried one by one by a collector.
+type tenantHealth struct {
+	up                   *prometheus.Desc
+	lastSuccessTimestamp *prometheus.Desc
+	querySamples         *prometheus.Desc
+	errors               *prometheus.Desc
+}
+
+func newTenantHealth(namespace, subsystem, tenantLabel string, constLabels prometheus.Labels) *tenantHealth {
+	return &tenantHealth{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "tenant_up"),
+			"Were the last queries of the tenant successful",
+			[]string{tenantLabel}, constLabels),
+		lastSuccessTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "tenant_last_success_timestamp_seconds"),
+			"When were the queries of the tenant successful for the last time",
+			[]string{tenantLabel}, constLabels),
+		querySamples: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "tenant_query_samples"),
+			"How many samples did the last queries of the tenant generate",
+			[]string{tenantLabel}, constLabels),
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "tenant_error"),
+			"Why did the last queries of the tenant fail, exported only for failing tenants",
+			[]string{tenantLabel, labelReason}, constLabels),
+	}
+}
+
+func (health *tenantHealth) collect(metrics chan<- prometheus.Metric, tenant string, stats *CollectStats, lastSuccess time.Time) {
+	var upf float64
+	if stats.Up {
+		upf = 1
+	}
+	metrics <- prometheus.MustNewConstMetric(health.up, prometheus.GaugeValue, upf, tenant)
+	metrics <- prometheus.MustNewConstMetric(health.querySamples, prometheus.GaugeValue, float64(stats.Samples), tenant)
+	if !lastSuccess.IsZero() {
+		metrics <- prometheus.MustNewConstMetric(
+			health.lastSuccessTimestamp, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9, tenant)
+	}
+	if !stats.Up && stats.ErrorReason != "" {
+		metrics <- prometheus.MustNewConstMetric(health.errors, prometheus.GaugeValue, 1, tenant, stats.ErrorReason)
+	}
+}
+
+// queryErrorReason categorizes the error of a query. The status code is the one of the last query response,
+// it is zero when no response was received.
+func queryErrorReason(err error, statusCode int) string {
+	var apiErr *promv1.Error
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		return errorReasonCircuitOpen
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorReasonTimeout
+	case errors.Is(err, context.Canceled):
+		return errorReasonCanceled
+	case errors.As(err, &apiErr):
+		httpError := apiErr.Type == promv1.ErrClient || apiErr.Type == promv1.ErrServer || apiErr.Type == promv1.ErrBadResponse
+		if httpError && statusCode != 0 && statusCode/100 != 2 {
+			return errorReasonHTTPPrefix + strconv.Itoa(statusCode)
+		}
+		if apiErr.Type == promv1.ErrBadResponse {
+			return errorReasonBadData
+		}
+		return string(apiErr.Type)
+	default:
+		return errorReasonUnavailable
+	}
+}
@@ -5,12 +5,20 @@ package metrics //nolint:revive,nolintlint // Package name metrics is intentiona
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
 )
 
 type CollectStats struct {
@@ -18,22 +26,238 @@ type CollectStats struct {
 	LatencyMillis int64
 	Samples       int
 	Warnings      int
+	// ErrorReason categorizes the first failure, it is empty when there was none.
+	ErrorReason string
+}
+
+// fail marks the stats as failed, the reason of an earlier failure is kept.
+func (stats *CollectStats) fail(reason string) {
+	stats.Up = false
+	if stats.ErrorReason == "" {
+		stats.ErrorReason = reason
+	}
+}
+
+// aggregateSeries accumulates the samples of a single label set of histogram and summary metrics.
+type aggregateSeries struct {
+	labelValues []string
+	buckets     map[float64]uint64
+	quantiles   map[float64]float64
+	infCount    uint64
+	count       uint64
+	hasCount    bool
+	sum         float64
+}
+
+// aggregateSet groups the samples of several queries by the values of the configured labels
+// and keeps the order in which the label sets were first seen.
+type aggregateSet struct {
+	labels []string
+	order  []string
+	series map[string]*aggregateSeries
+}
+
+func newAggregateSet(labels []string) *aggregateSet {
+	return &aggregateSet{labels: labels, series: make(map[string]*aggregateSeries)}
+}
+
+func (set *aggregateSet) get(sample *model.Sample) *aggregateSeries {
+	values := labelValues(sample.Metric, set.labels)
+	key := strings.Join(values, string(model.SeparatorByte))
+	if s, ok := set.series[key]; ok {
+		return s
+	}
+	s := &aggregateSeries{
+		labelValues: values,
+		buckets:     make(map[float64]uint64),
+		quantiles:   make(map[float64]float64),
+	}
+	set.series[key] = s
+	set.order = append(set.order, key)
+	return s
+}
+
+func (set *aggregateSet) each(fn func(s *aggregateSeries)) {
+	for _, key := range set.order {
+		fn(set.series[key])
+	}
 }
 
-func processCounterQuery(query *string, sourceLabels *[]string, metrics chan<- prometheus.Metric,
-	v1api promv1.API, desc *prometheus.Desc, metricType string) CollectStats {
+// metricEvaluation holds the state shared by all queries of a single evaluation of a configured metric.
+type metricEvaluation struct {
+	// ctx is the context of the scrape or of the background evaluation
+	ctx           context.Context
+	metric        *models.Metric
+	relabel       relabelRules
+	backend       *queryBackend
+	metrics       chan<- prometheus.Metric
+	evalTime      time.Time
+	timeout       time.Duration
+	withTimestamp bool
+	// labels are read from the query results, the tenant label is appended when the tenants are queried one by one
+	labels []string
+	// tenantStats are the statistics of the queries of every tenant queried one by one
+	tenantStats map[string]CollectStats
+}
+
+// newMetricEvaluation prepares the evaluation of the metric. The evaluation time is shifted back by the evaluation
+// delay of the metric, or of the source when the metric does not set one. Queries are cancelled with the context.
+func newMetricEvaluation(ctx context.Context, metric *models.Metric, relabel relabelRules, backend *queryBackend,
+	metrics chan<- prometheus.Metric) *metricEvaluation {
+	source := backend.source
+	delay := source.EvaluationDelay
+	if metric.EvaluationDelay != nil {
+		delay = *metric.EvaluationDelay
+	}
+	labels := metric.Labels
+	if len(backend.tenants) > 0 {
+		labels = append(slices.Clip(labels), backend.tenantLabel)
+	}
+	return &metricEvaluation{
+		ctx:           ctx,
+		metric:        metric,
+		relabel:       relabel,
+		backend:       backend,
+		metrics:       metrics,
+		evalTime:      time.Now().Add(-time.Duration(delay)),
+		timeout:       backend.queryTimeout(metric),
+		withTimestamp: source.ExportTimestamps || metric.ExportTimestamp,
+		labels:        labels,
+		tenantStats:   make(map[string]CollectStats),
+	}
+}
+
+// send sends the metric, stamped with the evaluation time when timestamps are enabled.
+func (e *metricEvaluation) send(metric prometheus.Metric) {
+	if e.withTimestamp {
+		metric = prometheus.NewMetricWithTimestamp(e.evalTime, metric)
+	}
+	e.metrics <- metric
+}
+
+// processMetric runs the queries of a configured metric and sends the results according to its type.
+func processMetric(e *metricEvaluation) CollectStats {
+	switch e.metric.Type {
+	case models.MetricTypeHistogram:
+		return processHistogramQuery(e)
+	case models.MetricTypeNativeHistogram:
+		return processNativeHistogramQuery(e)
+	case models.MetricTypeSummary:
+		return processSummaryQuery(e)
+	case models.MetricTypeCounter, models.MetricTypeGauge:
+		return processCounterQuery(e)
+	default:
+		log.Printf("Warning: skipping metric %q of unknown type: %q", e.metric.ID, e.metric.Type)
+		stats := CollectStats{}
+		stats.fail(errorReasonUnknownType)
+		return stats
+	}
+}
+
+// query evaluates the query at the evaluation time, or over the range of the metric evaluation ending
+// at the evaluation time when it is set, and returns the resulting vector.
+// The returned vector is nil when the query failed or returned no result.
+// When the tenants are queried one by one, the query is evaluated concurrently for every tenant and the results
+// are labeled with their tenant. It fails only when it failed for all the tenants, the statistics of every
+// tenant are recorded separately.
+func (e *metricEvaluation) query(query string) (model.Vector, CollectStats) {
+	tenants := e.backend.tenants
+	if len(tenants) == 0 {
+		return e.queryTenant(query, "")
+	}
+
+	vectors := make([]model.Vector, len(tenants))
+	tenantStats := make([]CollectStats, len(tenants))
+	var wg sync.WaitGroup
+	for i, tenant := range tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vectors[i], tenantStats[i] = e.queryTenant(query, tenant)
+		}()
+	}
+	wg.Wait()
+
+	var vector model.Vector
 	stats := CollectStats{}
+	for i, tenant := range tenants {
+		vector = append(vector, vectors[i]...)
+		previous, ok := e.tenantStats[tenant]
+		if !ok {
+			previous = CollectStats{Up: true}
+		}
+		reconcileStats(&previous, &tenantStats[i])
+		e.tenantStats[tenant] = previous
+
+		if tenantStats[i].Up {
+			stats.Up = true
+		} else if stats.ErrorReason == "" {
+			stats.ErrorReason = tenantStats[i].ErrorReason
+		}
+		stats.LatencyMillis = max(stats.LatencyMillis, tenantStats[i].LatencyMillis)
+		stats.Samples += tenantStats[i].Samples
+		stats.Warnings += tenantStats[i].Warnings
+	}
+	if stats.Up {
+		stats.ErrorReason = ""
+	}
+	return vector, stats
+}
+
+// queryOnce sends the query to the source for the tenant, or for the org of the source when it is empty,
+// and returns the status code of the response. The query is evaluated with the remaining time when the scrape
+// deadline comes before its timeout. Its latency, without the wait for a query slot, is added to the trace.
+func (e *metricEvaluation) queryOnce(query, tenant string, trace *QueryTrace) (model.Value, promv1.Warnings, int, error) {
+	if err := e.backend.acquire(e.ctx); err != nil {
+		return nil, nil, 0, err
+	}
+	defer e.backend.release()
 	start := time.Now()
-	timeout := 5 * time.Second
-	ctx := context.Background()
-	result, warns, err := v1api.Query(ctx, *query, time.Now(), promv1.WithTimeout(timeout))
-	stats.LatencyMillis = time.Since(start).Milliseconds()
+	defer func() { trace.Latency += time.Since(start) }()
+
+	timeout := e.timeout
+	if deadline, ok := e.ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	ctx, cancel := context.WithTimeout(e.ctx, timeout)
+	defer cancel()
+	ctx, status := withResponseStatus(ctx)
+	if tenant != "" {
+		ctx = withTenant(ctx, tenant)
+	}
+	var (
+		result model.Value
+		warns  promv1.Warnings
+		err    error
+	)
+	if evaluation := e.metric.Evaluation; evaluation == nil {
+		result, warns, err = e.backend.v1api.Query(ctx, query, e.evalTime, promv1.WithTimeout(timeout))
+	} else {
+		var queryRange promv1.Range
+		queryRange, err = evaluationRange(evaluation, e.evalTime)
+		if err == nil {
+			result, warns, err = e.backend.v1api.QueryRange(ctx, query, queryRange, promv1.WithTimeout(timeout))
+		}
+	}
+	return result, warns, *status, err
+}
+
+// queryTenant evaluates the query for the tenant, or for the org of the source when it is empty.
+func (e *metricEvaluation) queryTenant(query string, tenant string) (model.Vector, CollectStats) {
+	evaluation := e.metric.Evaluation
+	stats := CollectStats{}
+	trace := QueryTrace{MetricID: e.metric.ID, Query: query, Tenant: tenant}
+	defer traceQuery(e.ctx, &trace)
+	result, warns, status, err := e.queryWithRetries(query, tenant, &trace)
+	trace.Warnings = warns
+	stats.LatencyMillis = trace.Latency.Milliseconds()
 
 	if err != nil {
 		// TODO: use official log library
 		log.Printf("Error querying Prometheus: %v\n", err)
-		stats.Up = false
-		return stats
+		stats.fail(queryErrorReason(err, status))
+		trace.Err = err
+		return nil, stats
 	}
 
 	stats.Up = true
@@ -46,38 +270,312 @@ func processCounterQuery(query *string, sourceLabels *[]string, metrics chan<- p
 
 	if result == nil {
 		stats.Samples = 0
-		return stats
+		return nil, stats
+	}
+
+	var vector model.Vector
+	switch value := result.(type) {
+	case model.Vector:
+		vector = value
+	case model.Matrix:
+		aggregation := ""
+		if evaluation != nil {
+			aggregation = evaluation.Aggregation
+		}
+		vector, err = reduceMatrix(value, aggregation)
+		if err != nil {
+			log.Printf("Error reducing range query result: %v\n", err)
+			stats.fail(errorReasonBadData)
+			trace.Err = err
+			return nil, stats
+		}
+	default:
+		log.Printf("Error: unsupported query result type %q\n", result.Type())
+		stats.fail(errorReasonBadData)
+		trace.Err = fmt.Errorf("unsupported query result type %q", result.Type())
+		return nil, stats
+	}
+	if tenant != "" {
+		// the tenant label is set before relabeling, so that relabel configs can use it
+		for _, sample := range vector {
+			if sample.Metric == nil {
+				sample.Metric = make(model.Metric)
+			}
+			sample.Metric[model.LabelName(e.backend.tenantLabel)] = model.LabelValue(tenant)
+		}
 	}
+	vector = e.relabel.applyVector(vector)
+	stats.Samples = len(vector)
+	trace.Samples = stats.Samples
+	return vector, stats
+}
 
-	stats.Samples = len(result.(model.Vector))
+func processCounterQuery(e *metricEvaluation) CollectStats {
+	metric := e.metric
+	vector, stats := e.query(metric.Query)
 
 	// Return samples as-is, but rename labels.
-	for _, sample := range result.(model.Vector) {
-		destLabelValues := make([]string, len(*sourceLabels))
-		for i, sourceLabel := range *sourceLabels {
-			destLabelValues[i] = string(sample.Metric[model.LabelName(sourceLabel)])
-		}
+	for _, sample := range vector {
+		destLabelValues := labelValues(sample.Metric, e.labels)
 		// timestamp == 0 is probably not valid timestamp eg. response without value field
 		if sample.Timestamp == 0 {
-			stats.Up = false
+			stats.fail(errorReasonBadData)
+			continue
+		}
+		if sample.Histogram != nil {
+			log.Printf("Warning: skipping native histogram sample of %q metric, use %q type instead",
+				metric.Type, models.MetricTypeNativeHistogram)
+			stats.fail(errorReasonBadData)
 			continue
 		}
-		// Histogram, add le label as the last one.
-		var metric prometheus.Metric
-		switch metricType {
-		case "Counter":
-			metric = prometheus.MustNewConstMetric(
-				desc, prometheus.CounterValue,
+		var constMetric prometheus.Metric
+		switch metric.Type {
+		case models.MetricTypeCounter:
+			constMetric = prometheus.MustNewConstMetric(
+				metric.Description, prometheus.CounterValue,
 				float64(sample.Value), destLabelValues...)
-		case "Gauge":
-			metric = prometheus.MustNewConstMetric(
-				desc, prometheus.GaugeValue,
+		case models.MetricTypeGauge:
+			constMetric = prometheus.MustNewConstMetric(
+				metric.Description, prometheus.GaugeValue,
 				float64(sample.Value), destLabelValues...)
 		default:
-			log.Printf("Warning: skipping metric of unknown type: %q", metricType)
+			log.Printf("Warning: skipping metric of unknown type: %q", metric.Type)
+			stats.fail(errorReasonUnknownType)
+			continue
+		}
+		e.send(constMetric)
+	}
+	return stats
+}
+
+// processHistogramQuery combines the bucket, sum and count queries of the metric into const histograms.
+// Series are grouped by the values of the configured labels, the `le` label is read from the bucket samples
+// and must not be listed in the metric labels. Bucket counts are rounded to integers.
+func processHistogramQuery(e *metricEvaluation) CollectStats {
+	metric := e.metric
+	set := newAggregateSet(e.labels)
+
+	buckets, stats := e.query(metric.Query)
+	for _, sample := range buckets {
+		if sample.Timestamp == 0 {
+			stats.fail(errorReasonBadData)
 			continue
 		}
-		metrics <- metric
+		upperBound, err := strconv.ParseFloat(string(sample.Metric[model.BucketLabel]), 64)
+		if err != nil {
+			log.Printf("Warning: skipping bucket with invalid %q label of metric %q: %v", model.BucketLabel, metric.ID, err)
+			stats.fail(errorReasonBadData)
+			continue
+		}
+		s := set.get(sample)
+		if math.IsInf(upperBound, +1) {
+			s.infCount = roundCount(float64(sample.Value))
+			continue
+		}
+		s.buckets[upperBound] = roundCount(float64(sample.Value))
+	}
+
+	processSumAndCountQueries(e, set, &stats)
+
+	set.each(func(s *aggregateSeries) {
+		count := s.count
+		if !s.hasCount {
+			count = s.infCount
+		}
+		e.send(prometheus.MustNewConstHistogram(metric.Description, count, s.sum, s.buckets, s.labelValues...))
+	})
+	return stats
+}
+
+// processSummaryQuery combines the quantile, sum and count queries of the metric into const summaries.
+// Quantiles are read either from the `quantile` label of the Query result or from the keys of QuantileQueries,
+// the `quantile` label must not be listed in the metric labels.
+func processSummaryQuery(e *metricEvaluation) CollectStats {
+	metric := e.metric
+	set := newAggregateSet(e.labels)
+	stats := CollectStats{Up: true}
+
+	addQuantiles := func(vector model.Vector, quantile string) {
+		for _, sample := range vector {
+			if sample.Timestamp == 0 {
+				stats.fail(errorReasonBadData)
+				continue
+			}
+			value := quantile
+			if value == "" {
+				value = string(sample.Metric[model.QuantileLabel])
+			}
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				log.Printf("Warning: skipping sample with invalid quantile of metric %q: %v", metric.ID, err)
+				stats.fail(errorReasonBadData)
+				continue
+			}
+			set.get(sample).quantiles[q] = float64(sample.Value)
+		}
 	}
+
+	if metric.Query != "" {
+		vector, queryStats := e.query(metric.Query)
+		reconcileStats(&stats, &queryStats)
+		addQuantiles(vector, "")
+	}
+	// sort quantiles to send queries in a stable order
+	quantiles := make([]string, 0, len(metric.QuantileQueries))
+	for quantile := range metric.QuantileQueries {
+		quantiles = append(quantiles, quantile)
+	}
+	slices.Sort(quantiles)
+	for _, quantile := range quantiles {
+		vector, queryStats := e.query(metric.QuantileQueries[quantile])
+		reconcileStats(&stats, &queryStats)
+		addQuantiles(vector, quantile)
+	}
+
+	processSumAndCountQueries(e, set, &stats)
+
+	set.each(func(s *aggregateSeries) {
+		e.send(prometheus.MustNewConstSummary(metric.Description, s.count, s.sum, s.quantiles, s.labelValues...))
+	})
 	return stats
 }
+
+// processSumAndCountQueries adds results of the optional sum and count queries of the metric to the set.
+func processSumAndCountQueries(e *metricEvaluation, set *aggregateSet, stats *CollectStats) {
+	metric := e.metric
+	if metric.SumQuery != "" {
+		sums, sumStats := e.query(metric.SumQuery)
+		reconcileStats(stats, &sumStats)
+		for _, sample := range sums {
+			if sample.Timestamp == 0 {
+				stats.fail(errorReasonBadData)
+				continue
+			}
+			set.get(sample).sum = float64(sample.Value)
+		}
+	}
+
+	if metric.CountQuery != "" {
+		counts, countStats := e.query(metric.CountQuery)
+		reconcileStats(stats, &countStats)
+		for _, sample := range counts {
+			if sample.Timestamp == 0 {
+				stats.fail(errorReasonBadData)
+				continue
+			}
+			s := set.get(sample)
+			s.count = roundCount(float64(sample.Value))
+			s.hasCount = true
+		}
+	}
+}
+
+// processNativeHistogramQuery re-exports native histogram samples of the query result as const native histograms.
+// Samples without a histogram are skipped.
+func processNativeHistogramQuery(e *metricEvaluation) CollectStats {
+	metric := e.metric
+	vector, stats := e.query(metric.Query)
+
+	for _, sample := range vector {
+		if sample.Timestamp == 0 {
+			stats.fail(errorReasonBadData)
+			continue
+		}
+		if sample.Histogram == nil {
+			log.Printf("Warning: skipping float sample of native histogram metric %q", metric.ID)
+			stats.fail(errorReasonBadData)
+			continue
+		}
+		nh, err := newNativeHistogram(metric.Description, sample.Histogram, labelValues(sample.Metric, e.labels))
+		if err != nil {
+			log.Printf("Warning: skipping native histogram sample of metric %q: %v", metric.ID, err)
+			stats.fail(errorReasonBadData)
+			continue
+		}
+		e.send(nh)
+	}
+	return stats
+}
+
+// newNativeHistogram converts a native histogram returned by the query API into a const native histogram.
+// The query API returns bucket boundaries only, so the schema and bucket indexes are derived from them.
+// Const native histograms hold integer counts only, so histograms with fractional counts, e.g. results of rate(),
+// are rejected instead of being rounded.
+func newNativeHistogram(desc *prometheus.Desc, h *model.SampleHistogram, labelValues []string) (prometheus.Metric, error) {
+	var (
+		schema        int32
+		schemaKnown   bool
+		zeroThreshold float64
+		zeroCount     uint64
+	)
+	count, ok := exactCount(float64(h.Count))
+	if !ok {
+		return nil, fmt.Errorf("count %v is not an integer", h.Count)
+	}
+	positive := make(map[int]int64)
+	negative := make(map[int]int64)
+
+	for _, bucket := range h.Buckets {
+		lower, upper := float64(bucket.Lower), float64(bucket.Upper)
+		bucketCount, ok := exactCount(float64(bucket.Count))
+		if !ok {
+			return nil, fmt.Errorf("count %v of bucket [%v, %v] is not an integer", bucket.Count, lower, upper)
+		}
+
+		if lower <= 0 && upper >= 0 {
+			zeroThreshold = upper
+			zeroCount = bucketCount
+			continue
+		}
+
+		// the bucket bounds are 2^(index*2^-schema) and 2^((index-1)*2^-schema) for positive buckets,
+		// negative buckets mirror them
+		bound, ratio := upper, upper/lower
+		if upper < 0 {
+			bound, ratio = -lower, lower/upper
+		}
+		bucketSchema := -math.Log2(math.Log2(ratio))
+		if math.Abs(bucketSchema-math.Round(bucketSchema)) > 1e-6 {
+			return nil, fmt.Errorf("bucket [%v, %v] does not match any exponential schema", lower, upper)
+		}
+		if !schemaKnown {
+			schema = int32(math.Round(bucketSchema))
+			schemaKnown = true
+		} else if schema != int32(math.Round(bucketSchema)) {
+			return nil, fmt.Errorf("bucket [%v, %v] does not match schema %d", lower, upper, schema)
+		}
+
+		index := int(math.Round(math.Log2(bound) * math.Exp2(float64(schema))))
+		if upper < 0 {
+			negative[index] = int64(bucketCount)
+		} else {
+			positive[index] = int64(bucketCount)
+		}
+	}
+
+	return prometheus.NewConstNativeHistogram(desc, count, float64(h.Sum), positive, negative,
+		zeroCount, schema, zeroThreshold, time.Time{}, labelValues...)
+}
+
+func labelValues(labelSet model.Metric, sourceLabels []string) []string {
+	values := make([]string, len(sourceLabels))
+	for i, sourceLabel := range sourceLabels {
+		values[i] = string(labelSet[model.LabelName(sourceLabel)])
+	}
+	return values
+}
+
+func roundCount(value float64) uint64 {
+	if value < 0 || math.IsNaN(value) {
+		return 0
+	}
+	return uint64(math.Round(value))
+}
+
+// exactCount converts a non-negative integer value to a count, it reports false for any other value.
+func exactCount(value float64) (uint64, bool) {
+	if value < 0 || value != math.Trunc(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return uint64(value), true
+}
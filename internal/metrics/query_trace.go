@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTrace describes a single query sent to the source by a collector.
+type QueryTrace struct {
+	Collector string
+	MetricID  string
+	Query     string
+	// Tenant is set when the tenants of the source are queried one by one
+	Tenant  string
+	Latency time.Duration
+	// Retries is the number of times the query was sent again after a transient error
+	Retries  int
+	Samples  int
+	Warnings []string
+	// Err is the error of the query, or of processing its result.
+	Err error
+}
+
+// queryTraceKey is the context key of the function the queries are reported to.
+type queryTraceKey struct{}
+
+// WithQueryTrace returns a context in which every query evaluated by the collectors is reported to trace
+// once it completes. Queries of the same evaluation run concurrently, trace must be safe for concurrent use.
+func WithQueryTrace(ctx context.Context, trace func(QueryTrace)) context.Context {
+	return context.WithValue(ctx, queryTraceKey{}, trace)
+}
+
+// withCollectorTrace returns a context reporting the queries along with the name of the collector.
+func withCollectorTrace(ctx context.Context, collector string) context.Context {
+	trace, ok := ctx.Value(queryTraceKey{}).(func(QueryTrace))
+	if !ok {
+		return ctx
+	}
+	return WithQueryTrace(ctx, func(queryTrace QueryTrace) {
+		queryTrace.Collector = collector
+		trace(queryTrace)
+	})
+}
+
+// traceQuery reports the query when the context was created with WithQueryTrace.
+func traceQuery(ctx context.Context, queryTrace *QueryTrace) {
+	if trace, ok := ctx.Value(queryTraceKey{}).(func(QueryTrace)); ok {
+		trace(*queryTrace)
+	}
+}
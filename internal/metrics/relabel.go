@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// relabelRule is a relabel config with its defaults applied and the regex compiled.
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  model.LabelName
+	replacement  string
+	action       string
+}
+
+// relabelRules are the compiled relabel configs of a metric.
+type relabelRules []relabelRule
+
+func newRelabelRules(configs []models.RelabelConfig) (relabelRules, error) {
+	rules := make(relabelRules, 0, len(configs))
+	for i := range configs {
+		config := &configs[i]
+		rule := relabelRule{
+			sourceLabels: config.SourceLabels,
+			separator:    config.Separator,
+			targetLabel:  model.LabelName(config.TargetLabel),
+			replacement:  models.DefaultRelabelReplacement,
+			action:       config.Action,
+		}
+		if rule.separator == "" {
+			rule.separator = models.DefaultRelabelSeparator
+		}
+		if config.Replacement != nil {
+			rule.replacement = *config.Replacement
+		}
+		if rule.action == "" {
+			rule.action = models.RelabelReplace
+		}
+		expr := config.Regex
+		if expr == "" {
+			expr = models.DefaultRelabelRegex
+		}
+		regex, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel config %d: invalid regex %q: %w", i, expr, err)
+		}
+		rule.regex = regex
+
+		switch rule.action {
+		case models.RelabelReplace, models.RelabelHash:
+			if !model.LegacyValidation.IsValidLabelName(config.TargetLabel) {
+				return nil, fmt.Errorf("relabel config %d: invalid target label %q of %q action", i, config.TargetLabel, rule.action)
+			}
+		case models.RelabelKeep, models.RelabelDrop, models.RelabelLabelDrop, models.RelabelLabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel config %d: unknown action %q", i, rule.action)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ValidateRelabelConfigs checks that the relabel configs can be compiled.
+func ValidateRelabelConfigs(configs []models.RelabelConfig) error {
+	_, err := newRelabelRules(configs)
+	return err
+}
+
+// apply returns the relabeled copy of the labels, or false when the sample is dropped.
+func (rules relabelRules) apply(labels model.Metric) (model.Metric, bool) {
+	if len(rules) == 0 {
+		return labels, true
+	}
+	labels = labels.Clone()
+	for i := range rules {
+		if !rules[i].apply(labels) {
+			return nil, false
+		}
+	}
+	return labels, true
+}
+
+// applyVector relabels the samples of the vector in place and removes the dropped ones.
+func (rules relabelRules) applyVector(vector model.Vector) model.Vector {
+	if len(rules) == 0 {
+		return vector
+	}
+	kept := vector[:0]
+	for _, sample := range vector {
+		labels, ok := rules.apply(sample.Metric)
+		if !ok {
+			continue
+		}
+		sample.Metric = labels
+		kept = append(kept, sample)
+	}
+	return kept
+}
+
+func (rule *relabelRule) apply(labels model.Metric) bool {
+	values := make([]string, len(rule.sourceLabels))
+	for i, sourceLabel := range rule.sourceLabels {
+		values[i] = string(labels[model.LabelName(sourceLabel)])
+	}
+	value := strings.Join(values, rule.separator)
+
+	switch rule.action {
+	case models.RelabelKeep:
+		return rule.regex.MatchString(value)
+	case models.RelabelDrop:
+		return !rule.regex.MatchString(value)
+	case models.RelabelLabelDrop, models.RelabelLabelKeep:
+		keep := rule.action == models.RelabelLabelKeep
+		for name := range labels {
+			if rule.regex.MatchString(string(name)) != keep {
+				delete(labels, name)
+			}
+		}
+	case models.RelabelHash:
+		if value != "" {
+			sum := sha256.Sum256([]byte(value))
+			labels[rule.targetLabel] = model.LabelValue(hex.EncodeToString(sum[:]))
+		}
+	default:
+		match := rule.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			break
+		}
+		result := rule.regex.ExpandString(nil, rule.replacement, value, match)
+		if len(result) == 0 {
+			delete(labels, rule.targetLabel)
+			break
+		}
+		labels[rule.targetLabel] = model.LabelValue(result)
+	}
+	return true
+}
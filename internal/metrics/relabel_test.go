@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+func TestRelabelRules(t *testing.T) {
+	labels := model.Metric{
+		"__name__": "temp_temp",
+		"host":     "3d88ef10d9",
+		"hostGuid": "4c4c4544-0044-5810-804a-c2c04f384633",
+		"sensor":   "coretemp_core_0",
+	}
+	empty := ""
+	redacted := "redacted"
+	tests := []struct {
+		name     string
+		configs  []models.RelabelConfig
+		expected model.Metric
+		dropped  bool
+	}{
+		{
+			name: "replace with capture groups",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"sensor"}, Regex: "coretemp_(.+)", TargetLabel: "core"},
+			},
+			expected: model.Metric{
+				"__name__": "temp_temp",
+				"host":     "3d88ef10d9",
+				"hostGuid": "4c4c4544-0044-5810-804a-c2c04f384633",
+				"sensor":   "coretemp_core_0",
+				"core":     "core_0",
+			},
+		},
+		{
+			name: "replace joined values",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"host", "sensor"}, Separator: "/", TargetLabel: "host"},
+			},
+			expected: model.Metric{
+				"__name__": "temp_temp",
+				"host":     "3d88ef10d9/coretemp_core_0",
+				"hostGuid": "4c4c4544-0044-5810-804a-c2c04f384633",
+				"sensor":   "coretemp_core_0",
+			},
+		},
+		{
+			name: "regex is anchored",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"sensor"}, Regex: "core_0", TargetLabel: "core"},
+			},
+			expected: labels,
+		},
+		{
+			name: "redact and remove",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"hostGuid"}, Regex: ".+", TargetLabel: "hostGuid", Replacement: &redacted},
+				{TargetLabel: "host", Replacement: &empty},
+			},
+			expected: model.Metric{
+				"__name__": "temp_temp",
+				"hostGuid": "redacted",
+				"sensor":   "coretemp_core_0",
+			},
+		},
+		{
+			name: "hash",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"hostGuid"}, TargetLabel: "hostGuid", Action: models.RelabelHash},
+				{SourceLabels: []string{"missing"}, TargetLabel: "missing", Action: models.RelabelHash},
+			},
+			expected: model.Metric{
+				"__name__": "temp_temp",
+				"host":     "3d88ef10d9",
+				"hostGuid": "1940abf45d3610f8135ea65af7a8873c1c0a2a5d99107c915b0f772f582ac968",
+				"sensor":   "coretemp_core_0",
+			},
+		},
+		{
+			name: "label drop and keep",
+			configs: []models.RelabelConfig{
+				{Regex: "host.*", Action: models.RelabelLabelDrop},
+				{Regex: "__name__|sensor|hostGuid", Action: models.RelabelLabelKeep},
+			},
+			expected: model.Metric{
+				"__name__": "temp_temp",
+				"sensor":   "coretemp_core_0",
+			},
+		},
+		{
+			name: "keep",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"sensor"}, Regex: "coretemp_core_[0-3]", Action: models.RelabelKeep},
+			},
+			expected: labels,
+		},
+		{
+			name: "drop",
+			configs: []models.RelabelConfig{
+				{SourceLabels: []string{"sensor"}, Regex: "coretemp_.*", Action: models.RelabelDrop},
+			},
+			dropped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newRelabelRules(tt.configs)
+			require.NoError(t, err)
+			relabeled, ok := rules.apply(labels)
+			require.Equal(t, !tt.dropped, ok)
+			if !tt.dropped {
+				require.Equal(t, tt.expected, relabeled)
+			}
+		})
+	}
+	// the labels of the query result are not modified
+	require.Len(t, labels, 4)
+}
+
+func TestRelabelRulesInvalid(t *testing.T) {
+	for _, config := range []models.RelabelConfig{
+		{Regex: "(", TargetLabel: "foo"},
+		{SourceLabels: []string{"foo"}},
+		{SourceLabels: []string{"foo"}, TargetLabel: "foo-bar", Action: models.RelabelHash},
+		{Action: "hashmod"},
+	} {
+		_, err := newRelabelRules([]models.RelabelConfig{config})
+		require.Error(t, err, config)
+	}
+}
+
+func TestRelabelConfigFromJSON(t *testing.T) {
+	var metric models.Metric
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"relabelConfigs": [
+			{"sourceLabels": ["host"], "regex": "(.+)", "targetLabel": "node", "replacement": "node-$1"},
+			{"sourceLabels": ["host"], "targetLabel": "host", "replacement": ""}
+		],
+		"staticLabels": {"region": "eu"}
+	}`), &metric))
+	rules, err := newRelabelRules(metric.RelabelConfigs)
+	require.NoError(t, err)
+	relabeled, ok := rules.apply(model.Metric{"host": "a"})
+	require.True(t, ok)
+	require.Equal(t, model.Metric{"node": "node-a"}, relabeled)
+	require.Equal(t, map[string]string{"region": "eu"}, metric.StaticLabels)
+}
@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+const (
+	// DefaultMaxRetries is used when Retry.MaxRetries is not set.
+	DefaultMaxRetries = 2
+	// DefaultInitialBackoff is used when Retry.InitialBackoff is not set.
+	DefaultInitialBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is used when Retry.MaxBackoff is not set.
+	DefaultMaxBackoff = time.Second
+	// DefaultCircuitFailureThreshold is used when CircuitBreaker.FailureThreshold is not set.
+	DefaultCircuitFailureThreshold = 5
+	// DefaultCircuitCooldown is used when CircuitBreaker.Cooldown is not set.
+	DefaultCircuitCooldown = 30 * time.Second
+
+	// retryMinAttempt is the shortest time left by the scrape deadline after the backoff for a query to be retried.
+	retryMinAttempt = 500 * time.Millisecond
+)
+
+// Values of the circuit state series.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// errCircuitOpen is returned for the queries rejected by the circuit breaker of the source.
+var errCircuitOpen = errors.New("circuit breaker of the source is open")
+
+// retryPolicy is the retry configuration of a source with its defaults applied.
+type retryPolicy struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(retry *models.Retry) *retryPolicy {
+	policy := &retryPolicy{
+		maxRetries:     retry.MaxRetries,
+		initialBackoff: time.Duration(retry.InitialBackoff),
+		maxBackoff:     time.Duration(retry.MaxBackoff),
+	}
+	if policy.maxRetries <= 0 {
+		policy.maxRetries = DefaultMaxRetries
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = DefaultInitialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = max(DefaultMaxBackoff, policy.initialBackoff)
+	}
+	return policy
+}
+
+// backoff returns the delay before the given retry, counted from zero. Half of the delay is random,
+// so that the retries of the queries which failed together are spread.
+func (policy *retryPolicy) backoff(retry int) time.Duration {
+	backoff := policy.initialBackoff
+	for range retry {
+		if backoff >= policy.maxBackoff/2 {
+			backoff = policy.maxBackoff
+			break
+		}
+		backoff *= 2
+	}
+	backoff = min(backoff, policy.maxBackoff)
+	return backoff/2 + rand.N(backoff/2+1) //nolint:gosec // the jitter does not need a secure random number
+}
+
+// circuitBreaker rejects the queries of a source after failureThreshold of them failed in a row with a transient
+// error. Once the cooldown is over, a single query probes the source, the circuit is closed again when it succeeds.
+type circuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	opened   atomic.Uint64
+	rejected atomic.Uint64
+}
+
+func newCircuitBreaker(config *models.CircuitBreaker) *circuitBreaker {
+	breaker := &circuitBreaker{
+		failureThreshold: config.FailureThreshold,
+		cooldown:         time.Duration(config.Cooldown),
+	}
+	if breaker.failureThreshold <= 0 {
+		breaker.failureThreshold = DefaultCircuitFailureThreshold
+	}
+	if breaker.cooldown <= 0 {
+		breaker.cooldown = DefaultCircuitCooldown
+	}
+	return breaker
+}
+
+// allow reports whether a query can be sent, the outcome of an allowed query must be recorded
+// with success, failure or ignore.
+func (breaker *circuitBreaker) allow() bool {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.failures < breaker.failureThreshold {
+		return true
+	}
+	if time.Now().Before(breaker.openUntil) || breaker.probing {
+		breaker.rejected.Add(1)
+		return false
+	}
+	breaker.probing = true
+	return true
+}
+
+func (breaker *circuitBreaker) success() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.probing = false
+	breaker.failures = 0
+}
+
+func (breaker *circuitBreaker) failure() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.probing = false
+	breaker.failures++
+	if breaker.failures < breaker.failureThreshold {
+		return
+	}
+	now := time.Now()
+	if !now.Before(breaker.openUntil) {
+		breaker.opened.Add(1)
+	}
+	breaker.openUntil = now.Add(breaker.cooldown)
+}
+
+// ignore records the outcome of a query which tells nothing about the source, e.g. a query canceled by the scrape.
+func (breaker *circuitBreaker) ignore() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.probing = false
+}
+
+func (breaker *circuitBreaker) state() int {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch {
+	case breaker.failures < breaker.failureThreshold:
+		return circuitClosed
+	case time.Now().Before(breaker.openUntil):
+		return circuitOpen
+	default:
+		return circuitHalfOpen
+	}
+}
+
+// transientErrorReason reports whether a query failing with the reason may succeed when it is sent again.
+func transientErrorReason(reason string) bool {
+	switch reason {
+	case errorReasonUnavailable, errorReasonTimeout:
+		return true
+	}
+	status, ok := strings.CutPrefix(reason, errorReasonHTTPPrefix)
+	if !ok {
+		return false
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && (code >= 500 || code == 429)
+}
+
+// queryWithRetries sends the query and retries it when it fails with a transient error, as long as the retries
+// of the source allow it and the scrape does not time out during the backoff. It returns the status code
+// of the last response. The query is rejected without being sent while the circuit breaker of the source is open.
+func (e *metricEvaluation) queryWithRetries(query, tenant string, trace *QueryTrace) (model.Value, promv1.Warnings, int, error) {
+	breaker := e.backend.breaker
+	if breaker != nil && !breaker.allow() {
+		return nil, nil, 0, errCircuitOpen
+	}
+	for retry := 0; ; retry++ {
+		result, warns, status, err := e.queryOnce(query, tenant, trace)
+		transient := err != nil && transientErrorReason(queryErrorReason(err, status))
+		if transient && e.retryAfter(retry) {
+			// TODO: use official log library
+			log.Printf("Retrying query of metric %q after error: %v\n", e.metric.ID, err)
+			trace.Retries++
+			e.backend.retries.Add(1)
+			continue
+		}
+		if breaker != nil {
+			switch {
+			case transient && e.ctx.Err() == nil:
+				breaker.failure()
+			case err != nil && e.ctx.Err() != nil:
+				breaker.ignore()
+			default:
+				// the source answered, even when the query itself is wrong
+				breaker.success()
+			}
+		}
+		return result, warns, status, err
+	}
+}
+
+// retryAfter waits for the backoff of the retry and reports whether the query can be sent again. The query is
+// not retried when the scrape deadline leaves less than retryMinAttempt, or the query timeout if shorter,
+// for the attempt after the backoff, as it would be cut off by the deadline.
+func (e *metricEvaluation) retryAfter(retry int) bool {
+	policy := e.backend.retry
+	if policy == nil || retry >= policy.maxRetries || e.ctx.Err() != nil {
+		return false
+	}
+	backoff := policy.backoff(retry)
+	if deadline, ok := e.ctx.Deadline(); ok && time.Until(deadline) <= backoff+min(e.timeout, retryMinAttempt) {
+		return false
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-e.ctx.Done():
+		return false
+	}
+}
+
+// sourceHealth exports the retries and the circuit breaker state of the sources configuring them.
+type sourceHealth struct {
+	backends      []*queryBackend
+	retries       *prometheus.Desc
+	circuitState  *prometheus.Desc
+	circuitOpened *prometheus.Desc
+	rejected      *prometheus.Desc
+}
+
+func newSourceHealth(namespace string, constLabels prometheus.Labels, backends []*queryBackend) *sourceHealth {
+	labels := []string{labelSource}
+	return &sourceHealth{
+		backends: backends,
+		retries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "query_retries_total"),
+			"How many times were the queries of the source retried after a transient error",
+			labels, constLabels),
+		circuitState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "circuit_state"),
+			"State of the circuit breaker of the source: 0 closed, 1 open, 2 half-open",
+			labels, constLabels),
+		circuitOpened: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "circuit_opened_total"),
+			"How many times was the circuit breaker of the source opened",
+			labels, constLabels),
+		rejected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, SourceSubsystem, "queries_rejected_total"),
+			"How many queries were not sent because the circuit breaker of the source was open",
+			labels, constLabels),
+	}
+}
+
+func (health *sourceHealth) Describe(descs chan<- *prometheus.Desc) {
+	descs <- health.retries
+	descs <- health.circuitState
+	descs <- health.circuitOpened
+	descs <- health.rejected
+}
+
+func (health *sourceHealth) Collect(metrics chan<- prometheus.Metric) {
+	for _, backend := range health.backends {
+		source := backend.name
+		if source == "" {
+			source = defaultSourceName
+		}
+		if backend.retry != nil {
+			metrics <- prometheus.MustNewConstMetric(health.retries, prometheus.CounterValue, float64(backend.retries.Load()), source)
+		}
+		if breaker := backend.breaker; breaker != nil {
+			metrics <- prometheus.MustNewConstMetric(health.circuitState, prometheus.GaugeValue, float64(breaker.state()), source)
+			metrics <- prometheus.MustNewConstMetric(
+				health.circuitOpened, prometheus.CounterValue, float64(breaker.opened.Load()), source)
+			metrics <- prometheus.MustNewConstMetric(
+				health.rejected, prometheus.CounterValue, float64(breaker.rejected.Load()), source)
+		}
+	}
+}
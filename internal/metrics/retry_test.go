@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics //nolint:revive,nolintlint // Package name metrics is intentional
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-edge-platform/o11y-sre-exporter/internal/models"
+)
+
+// newFlakyServer returns a query API answering with a 503 status until it failed the given number of times,
+// the queries it received are counted.
+func newFlakyServer(t *testing.T, failures *atomic.Int64, queries *atomic.Int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		queries.Add(1)
+		if failures.Add(-1) >= 0 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := rw.Write([]byte(fallbackQueryResponse))
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newResilienceTestPipeline(t *testing.T, source models.Source) (*TestPipeline, []prometheus.Collector) {
+	config := models.Configuration{
+		Namespace: "orch",
+		Source:    source,
+		Collectors: []models.Collector{{
+			Name:    "api",
+			Enabled: true,
+			Metrics: []models.Metric{{ID: "targets", Query: "up", Type: models.MetricTypeGauge}},
+		}},
+	}
+	collectors, err := BuildCollectorsFromConfig(&config, "test-customer")
+	require.NoError(t, err)
+	ppl := NewPipeline()
+	ppl.AddCollectors(collectors...)
+	return ppl, collectors
+}
+
+// gatherSourceHealth gathers the source health series, they are collected concurrently with the evaluation
+// of the metrics by a scrape and describe the source before it.
+func gatherSourceHealth(t *testing.T, collectors []prometheus.Collector) map[string]*dto.MetricFamily {
+	ppl := NewPipeline()
+	ppl.AddCollectors(collectors[1:]...)
+	return gatherFamilies(t, ppl.registry)
+}
+
+func familyValue(t *testing.T, families map[string]*dto.MetricFamily, name string) float64 {
+	family, ok := families[name]
+	require.True(t, ok, "missing %s", name)
+	metric := family.GetMetric()[0]
+	if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetGauge().GetValue()
+}
+
+func TestCollectorRetries(t *testing.T) {
+	var failures, queries atomic.Int64
+	failures.Store(4)
+	server := newFlakyServer(t, &failures, &queries)
+
+	source := models.Source{URI: server.URL, Retry: &models.Retry{MaxRetries: 3, InitialBackoff: model.Duration(time.Millisecond)}}
+	ppl, collectors := newResilienceTestPipeline(t, source)
+	backend := collectors[0].(*GenericCollector).backends[0]
+
+	// the query fails for all the attempts
+	families := gatherFamilies(t, ppl.registry)
+	require.Equal(t, int64(4), queries.Load())
+	require.InDelta(t, 0, familyValue(t, families, "orch_api_up"), 0)
+	require.InDelta(t, 3, familyValue(t, gatherSourceHealth(t, collectors), "orch_source_query_retries_total"), 0)
+
+	// the query succeeds after a retry
+	failures.Store(1)
+	families = gatherFamilies(t, ppl.registry)
+	require.Equal(t, int64(6), queries.Load())
+	require.InDelta(t, 1, familyValue(t, families, "orch_api_up"), 0)
+	require.InDelta(t, 1, familyValue(t, families, "orch_api_targets"), 0)
+	require.Equal(t, uint64(4), backend.retries.Load())
+
+	t.Run("retries are limited by the scrape deadline", func(t *testing.T) {
+		failures.Store(100)
+		queries.Store(0)
+		backend.retry.initialBackoff = time.Hour
+		backend.retry.maxBackoff = time.Hour
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		metrics := make(chan prometheus.Metric, 100)
+		start := time.Now()
+		collectors[0].(*GenericCollector).CollectWithContext(ctx, metrics)
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, int64(1), queries.Load())
+	})
+
+	t.Run("retries need time for the attempt after the backoff", func(t *testing.T) {
+		failures.Store(100)
+		queries.Store(0)
+		backend.retry.initialBackoff = time.Millisecond
+		backend.retry.maxBackoff = time.Millisecond
+		ctx, cancel := context.WithTimeout(t.Context(), retryMinAttempt/2)
+		defer cancel()
+		metrics := make(chan prometheus.Metric, 100)
+		collectors[0].(*GenericCollector).CollectWithContext(ctx, metrics)
+		require.Equal(t, int64(1), queries.Load())
+	})
+}
+
+func TestCollectorCircuitBreaker(t *testing.T) {
+	var failures, queries atomic.Int64
+	server := newFlakyServer(t, &failures, &queries)
+
+	source := models.Source{URI: server.URL, CircuitBreaker: &models.CircuitBreaker{FailureThreshold: 2, Cooldown: model.Duration(time.Hour)}}
+	ppl, collectors := newResilienceTestPipeline(t, source)
+	breaker := collectors[0].(*GenericCollector).backends[0].breaker
+
+	families := gatherFamilies(t, ppl.registry)
+	require.InDelta(t, 1, familyValue(t, families, "orch_api_targets"), 0)
+	require.InDelta(t, circuitClosed, familyValue(t, gatherSourceHealth(t, collectors), "orch_source_circuit_state"), 0)
+
+	// the circuit opens after two failures
+	failures.Store(100)
+	for range 2 {
+		families = gatherFamilies(t, ppl.registry)
+		require.NotContains(t, families, "orch_api_targets")
+	}
+	require.InDelta(t, circuitOpen, familyValue(t, gatherSourceHealth(t, collectors), "orch_source_circuit_state"), 0)
+	require.Equal(t, int64(3), queries.Load())
+
+	// the source is not queried while the circuit is open, the last results are served with the staleness marker
+	families = gatherFamilies(t, ppl.registry)
+	require.Equal(t, int64(3), queries.Load())
+	require.InDelta(t, 1, familyValue(t, families, "orch_api_targets"), 0)
+	require.InDelta(t, 1, familyValue(t, families, "orch_api_metric_stale"), 0)
+	require.InDelta(t, 0, familyValue(t, families, "orch_api_metric_up"), 0)
+	for _, label := range families["orch_api_metric_error"].GetMetric()[0].GetLabel() {
+		if label.GetName() == labelReason {
+			require.Equal(t, errorReasonCircuitOpen, label.GetValue())
+		}
+	}
+	sourceHealth := gatherSourceHealth(t, collectors)
+	require.InDelta(t, 1, familyValue(t, sourceHealth, "orch_source_circuit_opened_total"), 0)
+	require.InDelta(t, 1, familyValue(t, sourceHealth, "orch_source_queries_rejected_total"), 0)
+
+	// a single query probes the source once the cooldown is over
+	breaker.mu.Lock()
+	breaker.openUntil = time.Now()
+	breaker.mu.Unlock()
+	require.Equal(t, circuitHalfOpen, breaker.state())
+	failures.Store(0)
+	families = gatherFamilies(t, ppl.registry)
+	require.Equal(t, int64(4), queries.Load())
+	require.InDelta(t, circuitClosed, familyValue(t, gatherSourceHealth(t, collectors), "orch_source_circuit_state"), 0)
+	require.NotContains(t, families, "orch_api_metric_stale")
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := newRetryPolicy(&models.Retry{InitialBackoff: model.Duration(100 * time.Millisecond)})
+	require.Equal(t, DefaultMaxRetries, policy.maxRetries)
+	for retry, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second} {
+		for range 10 {
+			backoff := policy.backoff(retry)
+			require.GreaterOrEqual(t, backoff, expected/2)
+			require.LessOrEqual(t, backoff, expected)
+		}
+	}
+	require.True(t, transientErrorReason("http_503"))
+	require.True(t, transientErrorReason("http_429"))
+	require.True(t, transientErrorReason(errorReasonUnavailable))
+	require.False(t, transientErrorReason("http_400"))
+	require.False(t, transientErrorReason(errorReasonCanceled))
+	require.False(t, transientErrorReason(errorReasonCircuitOpen))
+}
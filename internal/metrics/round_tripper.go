@@ -4,17 +4,35 @@
 package metrics //nolint:revive,nolintlint // Package name metrics is intentional
 
 import (
+	"context"
 	"net/http"
-
-	"github.com/prometheus/client_golang/api"
 )
 
 const (
 	HeaderXScopeOrgID = "X-Scope-OrgID"
 )
 
-func newMimirRoundTripper(mimirScopeOrgID *string) *mimirRoundTripper {
-	return &mimirRoundTripper{rt: api.DefaultRoundTripper, mimirScopeOrgID: mimirScopeOrgID}
+// responseStatusKey is the context key of the status code recorded by the round tripper.
+type responseStatusKey struct{}
+
+// withResponseStatus returns a context in which the round tripper records the status code of the response
+// to the returned variable. It can be read once the request completes.
+func withResponseStatus(ctx context.Context) (context.Context, *int) {
+	status := new(int)
+	return context.WithValue(ctx, responseStatusKey{}, status), status
+}
+
+// tenantKey is the context key of the tenant a single query is sent to.
+type tenantKey struct{}
+
+// withTenant returns a context in which the round tripper sends the request to the tenant
+// instead of the org of the source.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func newMimirRoundTripper(rt http.RoundTripper, mimirScopeOrgID *string) *mimirRoundTripper {
+	return &mimirRoundTripper{rt: rt, mimirScopeOrgID: mimirScopeOrgID}
 }
 
 type mimirRoundTripper struct {
@@ -35,8 +53,16 @@ func (s mimirRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		for k, v := range r.Header {
 			r2.Header[k] = v
 		}
-		r2.Header.Set(HeaderXScopeOrgID, *s.mimirScopeOrgID)
+		orgID := *s.mimirScopeOrgID
+		if tenant, ok := r.Context().Value(tenantKey{}).(string); ok {
+			orgID = tenant
+		}
+		r2.Header.Set(HeaderXScopeOrgID, orgID)
 		r = r2
 	}
-	return s.rt.RoundTrip(r)
+	resp, err := s.rt.RoundTrip(r)
+	if status, ok := r.Context().Value(responseStatusKey{}).(*int); ok && err == nil {
+		*status = resp.StatusCode
+	}
+	return resp, err
 }
@@ -25,7 +25,7 @@ func (m *mockRoundTrip) RoundTrip(r *http.Request) (*http.Response, error) {
 func TestMimirRoundTripper(t *testing.T) {
 	testScopeOrg := "12345"
 	canonicalHeaderXScopeOrgID := http.CanonicalHeaderKey(HeaderXScopeOrgID)
-	mimirRT := newMimirRoundTripper(&testScopeOrg)
+	mimirRT := newMimirRoundTripper(nil, &testScopeOrg)
 
 	t.Run("header is added", func(t *testing.T) {
 		mimirRT.rt = newRoundTripMock(t, http.Header{canonicalHeaderXScopeOrgID: []string{testScopeOrg}})
@@ -44,6 +44,14 @@ func TestMimirRoundTripper(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("tenant of the context is used", func(t *testing.T) {
+		mimirRT.rt = newRoundTripMock(t, http.Header{canonicalHeaderXScopeOrgID: []string{"tenant-a"}})
+		req := newTestRequest(nil)
+		req = req.WithContext(withTenant(req.Context(), "tenant-a"))
+		_, err := mimirRT.RoundTrip(req)
+		require.NoError(t, err)
+	})
+
 	t.Run("header is not changed when 'X-Scope-OrgID' present", func(t *testing.T) {
 		expectedOrgID := "123"
 		expectedHeader := http.Header{HeaderXScopeOrgID: []string{expectedOrgID}}
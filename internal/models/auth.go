@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package models
+
+// BasicAuth authenticates the queries with a username and a password.
+type BasicAuth struct {
+	Username string `json:"username"`
+	// Password is read once when the configuration is loaded, it supports ${VAR} and file:// references.
+	Password string `json:"password,omitempty"`
+	// PasswordFile is read again when it changes, so that the password can be rotated.
+	PasswordFile string `json:"passwordFile,omitempty"`
+}
+
+// TLSConfig configures the TLS connections to the source.
+type TLSConfig struct {
+	// CAFile is the CA bundle the certificate of the source is verified with, the system roots when it is not set.
+	CAFile string `json:"caFile,omitempty"`
+	// CertFile and KeyFile are the client certificate and its key, they are read on every TLS handshake,
+	// so that the certificate can be rotated.
+	CertFile   string `json:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// OAuth2 authenticates the queries with the access tokens of the client credentials grant, e.g. of Keycloak.
+type OAuth2 struct {
+	ClientID string `json:"clientId"`
+	// ClientSecret is read once when the configuration is loaded, it supports ${VAR} and file:// references.
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// ClientSecretFile is read again when it changes, so that the secret can be rotated.
+	ClientSecretFile string            `json:"clientSecretFile,omitempty"`
+	TokenURL         string            `json:"tokenURL"`
+	Scopes           []string          `json:"scopes,omitempty"`
+	EndpointParams   map[string]string `json:"endpointParams,omitempty"`
+}
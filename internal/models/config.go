@@ -5,6 +5,36 @@ package models
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Supported values of Metric.Type.
+const (
+	MetricTypeCounter   = "Counter"
+	MetricTypeGauge     = "Gauge"
+	MetricTypeHistogram = "Histogram"
+	MetricTypeSummary   = "Summary"
+	// MetricTypeNativeHistogram re-exports native (sparse) histogram samples returned by the query.
+	// The samples must have integer counts, fractional counts, e.g. results of rate(), are rejected.
+	MetricTypeNativeHistogram = "NativeHistogram"
+)
+
+// Supported values of Source.TenantMode.
+const (
+	// TenantModeFederated sends the tenants of Source.Org joined with "|" in a single X-Scope-OrgID header,
+	// Mimir then runs a federated query across them.
+	TenantModeFederated = "federated"
+	// TenantModePerTenant runs every query once per tenant of Source.Org and labels the results with the tenant.
+	TenantModePerTenant = "perTenant"
+)
+
+// Supported values of Fallback.Strategy.
+const (
+	// FallbackStrategyFailover queries the next endpoint when the previous one failed.
+	FallbackStrategyFailover = "failover"
+	// FallbackStrategyHedged also queries the next endpoint when the previous one did not answer within Fallback.HedgeDelay,
+	// the first successful response is used.
+	FallbackStrategyHedged = "hedged"
 )
 
 type Metric struct {
@@ -17,23 +47,110 @@ type Metric struct {
 	Labels      []string         `json:"labels"`
 	DestLabels  []string         `json:"destLabels"`
 	Type        string           `json:"Type"`
+	// SumQuery and CountQuery are used only by Histogram and Summary metrics.
+	// For Histogram metrics Query returns the `_bucket` series and when CountQuery is empty
+	// the count is taken from the `+Inf` bucket.
+	SumQuery   string `json:"sumQuery,omitempty"`
+	CountQuery string `json:"countQuery,omitempty"`
+	// QuantileQueries maps a quantile to the query returning its value, used only by Summary metrics
+	// in addition to or instead of a Query returning series with the `quantile` label.
+	QuantileQueries map[string]string `json:"quantileQueries,omitempty"`
+	// Evaluation is optional, metrics without it are evaluated with an instant query.
+	Evaluation *Evaluation `json:"evaluation,omitempty"`
+	// EvaluationDelay overrides Source.EvaluationDelay when set, 0s evaluates the metric without delay.
+	EvaluationDelay *model.Duration `json:"evaluationDelay,omitempty"`
+	// ExportTimestamp stamps the exported samples with the evaluation time, also enabled by Source.ExportTimestamps.
+	ExportTimestamp bool `json:"exportTimestamp,omitempty"`
+	// QueryTimeout overrides Source.QueryTimeout when set.
+	QueryTimeout model.Duration `json:"queryTimeout,omitempty"`
+	// RelabelConfigs transform the labels of the query results before Labels are read from them.
+	RelabelConfigs []RelabelConfig `json:"relabelConfigs,omitempty"`
+	// StaticLabels are added to every exported series of the metric.
+	StaticLabels map[string]string `json:"staticLabels,omitempty"`
+	// Source is the name of the source the metric is queried from, it overrides Collector.Source when set.
+	Source string `json:"source,omitempty"`
 }
 
 type Collector struct {
 	Name    string   `json:"name"`
 	Enabled bool     `json:"enabled"`
 	Metrics []Metric `json:"metrics"`
+	// EvaluationInterval enables evaluation of the metrics in the background, scrapes then serve
+	// the latest results. Metrics are evaluated on every scrape when it is not set.
+	EvaluationInterval model.Duration `json:"evaluationInterval,omitempty"`
+	// Source is the name of the source the metrics are queried from, Configuration.Source when it is not set.
+	Source string `json:"source,omitempty"`
 }
 
 type Source struct {
 	URI string `json:"queryURI"`
 	Org string `json:"mimirOrg"`
+	// EvaluationDelay shifts the evaluation time of queries back, so that they are not evaluated
+	// against data which is not completely ingested yet.
+	EvaluationDelay model.Duration `json:"evaluationDelay,omitempty"`
+	// ExportTimestamps stamps the exported samples of all metrics with their evaluation time.
+	ExportTimestamps bool `json:"exportTimestamps,omitempty"`
+	// MaxConcurrentQueries limits the number of queries in flight to the source.
+	MaxConcurrentQueries int `json:"maxConcurrentQueries,omitempty"`
+	// QueryTimeout limits the duration of every query, queries are also cancelled when the scrape times out.
+	QueryTimeout model.Duration `json:"queryTimeout,omitempty"`
+	// TenantMode selects how the tenants of Org are queried, TenantModeFederated when it is not set.
+	TenantMode string `json:"tenantMode,omitempty"`
+	// TenantLabel is the label holding the tenant of the results in TenantModePerTenant, "tenant" when it is not set.
+	TenantLabel string `json:"tenantLabel,omitempty"`
+	// BasicAuth, BearerTokenFile and OAuth2 authenticate the queries, only one of them can be set.
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+	// BearerTokenFile is read again when it changes, so that the token can be rotated.
+	BearerTokenFile string     `json:"bearerTokenFile,omitempty"`
+	OAuth2          *OAuth2    `json:"oauth2,omitempty"`
+	TLS             *TLSConfig `json:"tls,omitempty"`
+	// Fallback lists the endpoints queried when URI is unavailable, e.g. the other replicas of the query-frontend.
+	Fallback *Fallback `json:"fallback,omitempty"`
+	// Retry retries the queries failing with a transient error, e.g. a 503 status or a connection reset.
+	Retry *Retry `json:"retry,omitempty"`
+	// CircuitBreaker stops querying the source while it is failing, the last results of the metrics are served instead.
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+}
+
+// Fallback configures the endpoints of a source in addition to Source.URI. An endpoint failing FailureThreshold
+// times in a row is skipped for Cooldown, unless all the endpoints are skipped.
+type Fallback struct {
+	// QueryURIs are tried in order after Source.URI, they serve the same API with the same authentication.
+	QueryURIs []string `json:"queryURIs"`
+	// Strategy is FallbackStrategyFailover when it is not set.
+	Strategy string `json:"strategy,omitempty"`
+	// HedgeDelay is used only by FallbackStrategyHedged, 1s when it is not set.
+	HedgeDelay model.Duration `json:"hedgeDelay,omitempty"`
+	// FailureThreshold is 3 and Cooldown is 30s when they are not set.
+	FailureThreshold int            `json:"failureThreshold,omitempty"`
+	Cooldown         model.Duration `json:"cooldown,omitempty"`
+}
+
+// Retry configures the retries of the failed queries. The backoff doubles after every attempt up to MaxBackoff,
+// with a random jitter, and a query is not retried when the scrape would time out before the next attempt.
+type Retry struct {
+	// MaxRetries is 2 when it is not set.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// InitialBackoff is 100ms and MaxBackoff is 1s when they are not set.
+	InitialBackoff model.Duration `json:"initialBackoff,omitempty"`
+	MaxBackoff     model.Duration `json:"maxBackoff,omitempty"`
+}
+
+// CircuitBreaker opens after FailureThreshold queries in a row failed with a transient error, after their retries.
+// The queries are then rejected without being sent for Cooldown, before a single query probes the source again.
+type CircuitBreaker struct {
+	// FailureThreshold is 5 and Cooldown is 30s when they are not set.
+	FailureThreshold int            `json:"failureThreshold,omitempty"`
+	Cooldown         model.Duration `json:"cooldown,omitempty"`
 }
 
 type Configuration struct {
-	Namespace  string      `json:"namespace"`
-	Source     Source      `json:"source"`
-	Collectors []Collector `json:"collectors"`
+	Namespace string `json:"namespace"`
+	// Source is the default source, the metrics are queried from it unless they select one of Sources.
+	Source Source `json:"source"`
+	// Sources are named sources the collectors and metrics can select.
+	Sources    map[string]Source `json:"sources,omitempty"`
+	Collectors []Collector       `json:"collectors"`
 }
 
 type ConfigReloaderParameters struct {
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package models
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Supported values of Evaluation.Aggregation.
+const (
+	AggregationLast = "last"
+	AggregationMin  = "min"
+	AggregationMax  = "max"
+	AggregationAvg  = "avg"
+)
+
+// DefaultEvaluationStep is used when Evaluation.Step is not set.
+const DefaultEvaluationStep = model.Duration(time.Minute)
+
+// Evaluation switches a metric from an instant query to a range query. Every series of the
+// resulting matrix is reduced to a single sample with the aggregation before it is exported.
+// Range and Step use the Prometheus duration format, e.g. "24h" or "5m".
+type Evaluation struct {
+	Range       model.Duration `json:"range"`
+	Step        model.Duration `json:"step,omitempty"`
+	Aggregation string         `json:"aggregation,omitempty"`
+}
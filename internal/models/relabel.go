@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: (C) 2026 Intel Corporation
+// SPDX-License-Identifier: Apache-2.0
+
+package models
+
+// Supported values of RelabelConfig.Action.
+const (
+	// RelabelReplace sets TargetLabel to Replacement when Regex matches the joined SourceLabels values,
+	// capture groups of Regex are expanded in Replacement. TargetLabel is removed when the result is empty.
+	RelabelReplace = "replace"
+	// RelabelHash sets TargetLabel to the hex encoded SHA-256 of the joined SourceLabels values,
+	// e.g. to hash identifiers before they leave the cluster. Empty values are kept empty.
+	RelabelHash = "hash"
+	// RelabelKeep drops the samples for which Regex does not match the joined SourceLabels values.
+	RelabelKeep = "keep"
+	// RelabelDrop drops the samples for which Regex matches the joined SourceLabels values.
+	RelabelDrop = "drop"
+	// RelabelLabelDrop removes the labels with names matching Regex.
+	RelabelLabelDrop = "labeldrop"
+	// RelabelLabelKeep removes the labels with names not matching Regex.
+	RelabelLabelKeep = "labelkeep"
+)
+
+// Defaults of the optional RelabelConfig fields, same as in Prometheus relabel_config.
+const (
+	DefaultRelabelSeparator   = ";"
+	DefaultRelabelRegex       = "(.*)"
+	DefaultRelabelReplacement = "$1"
+)
+
+// RelabelConfig is a Prometheus relabel_config style rule applied to the labels of the query results
+// before the metric is created, in the order of configuration. Regex is fully anchored.
+// Labels created by the rules are exported only when they are listed in Metric.Labels.
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    string   `json:"separator,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Replacement  *string  `json:"replacement,omitempty"`
+	Action       string   `json:"action,omitempty"`
+}